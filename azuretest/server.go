@@ -0,0 +1,1037 @@
+// Package azuretest provides a fake Azure Resource Manager and Azure AD server for
+// tests of code talking to the Azure Monitor API.
+package azuretest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessToken is the token handed out by the fake Azure AD endpoint and required
+// by the fake Azure Resource Manager endpoints.
+const AccessToken = "azuretest-token"
+
+// LogAnalyticsAccessToken is the token handed out for the Log Analytics API and
+// required by the fake Log Analytics endpoints.
+const LogAnalyticsAccessToken = "azuretest-loganalytics-token"
+
+// AppInsightsAccessToken is the token handed out for the Application Insights API and
+// required by the fake Application Insights endpoints.
+const AppInsightsAccessToken = "azuretest-appinsights-token"
+
+// Resource is a resource known to the fake server.
+type Resource struct {
+	ID       string
+	Location string
+	Kind     string
+	Sku      string
+	Tags     map[string]string
+}
+
+// MetricDefinition is a metric defined for a resource type.
+type MetricDefinition struct {
+	// Namespace is the metric namespace, e.g. azure.vm.linux.guestmetrics. Metrics
+	// without one are in the default namespace of the resource type.
+	Namespace          string
+	Name               string
+	Unit               string
+	PrimaryAggregation string
+	Dimensions         []string
+	// TimeGrains are the time grains the metric is available in, e.g. PT5M. By default,
+	// it is available per minute.
+	TimeGrains []string
+}
+
+// DataPoint maps aggregation names as used in responses ("total", "average",
+// "minimum", "maximum") to their values. Missing aggregations are omitted from
+// responses, just like Azure does for time grains without data.
+type DataPoint map[string]float64
+
+// Timeseries is a timeseries of a metric, optionally for certain dimension values.
+type Timeseries struct {
+	Metadata map[string]string
+	Data     []DataPoint
+}
+
+// Metric holds the values returned for a metric of a resource.
+type Metric struct {
+	Namespace  string
+	Name       string
+	Unit       string
+	Timeseries []Timeseries
+}
+
+// AvailabilityStatus is the Resource Health status of a resource.
+type AvailabilityStatus struct {
+	State      string
+	ReasonType string
+	Summary    string
+}
+
+// CostResult is the result of a Cost Management query. Columns holding numbers in
+// the first row are typed as numbers.
+type CostResult struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// Usage is the usage of a subscription quota.
+type Usage struct {
+	Name         string
+	Unit         string
+	CurrentValue float64
+	Limit        float64
+}
+
+// LogQueryResult is the result of a Log Analytics query. Columns holding numbers in
+// the first row are typed as numbers.
+type LogQueryResult struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// AppInsightsSeries is a series of an Application Insights metric. Values are keyed by
+// the Application Insights aggregation names sum, avg, min and max.
+type AppInsightsSeries struct {
+	Segments map[string]string
+	Values   map[string]float64
+}
+
+// ActivityLogEvent is an event of the Activity Log.
+type ActivityLogEvent struct {
+	ID            string
+	Timestamp     time.Time
+	OperationName string
+	Status        string
+	ResourceType  string
+	Category      string
+	Caller        string
+	Claims        map[string]string
+}
+
+// AdvisorRecommendation is an Azure Advisor recommendation.
+type AdvisorRecommendation struct {
+	Category string
+	Impact   string
+	Problem  string
+}
+
+// SecureScore is a Defender for Cloud secure score.
+type SecureScore struct {
+	Name    string
+	Current float64
+	Max     float64
+}
+
+// Server is a fake Azure API. Requests are routed to it by the client returned by Client.
+type Server struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	resources     []Resource
+	groups        []string
+	definitions   map[string][]MetricDefinition
+	metrics       map[string]Metric
+	health        map[string]AvailabilityStatus
+	costs         map[string]CostResult
+	usages        map[string][]Usage
+	logQueries    map[string]LogQueryResult
+	appMetrics    map[string][]AppInsightsSeries
+	events        []ActivityLogEvent
+	advisor       []AdvisorRecommendation
+	secureScores  []SecureScore
+	requests      []string
+	tokenRequests int
+	pageSize      int
+}
+
+// NewServer starts a new fake Azure API server. It must be closed after use.
+func NewServer() *Server {
+	s := &Server{
+		definitions: make(map[string][]MetricDefinition),
+		metrics:     make(map[string]Metric),
+		health:      make(map[string]AvailabilityStatus),
+		costs:       make(map[string]CostResult),
+		usages:      make(map[string][]Usage),
+		logQueries:  make(map[string]LogQueryResult),
+		appMetrics:  make(map[string][]AppInsightsSeries),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Client returns an HTTP client that sends all requests, regardless of their
+// host, to the fake server.
+func (s *Server) Client() *http.Client {
+	target, _ := url.Parse(s.URL)
+	return &http.Client{
+		Transport: &rewriteTransport{target: target, next: http.DefaultTransport},
+	}
+}
+
+type rewriteTransport struct {
+	target *url.URL
+	next   http.RoundTripper
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+	u := *req.URL
+	u.Scheme = t.target.Scheme
+	u.Host = t.target.Host
+	r.URL = &u
+	r.Host = t.target.Host
+	return t.next.RoundTrip(r)
+}
+
+// AddResourceGroup adds an empty resource group. Groups of added resources are created implicitly.
+func (s *Server) AddResourceGroup(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addGroup(name)
+}
+
+func (s *Server) addGroup(name string) {
+	for _, g := range s.groups {
+		if strings.EqualFold(g, name) {
+			return
+		}
+	}
+	s.groups = append(s.groups, name)
+}
+
+// AddResource adds a resource that is returned by the resource list APIs.
+func (s *Server) AddResource(r Resource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resources = append(s.resources, r)
+	if group := segment(r.ID, "resourceGroups"); group != "" {
+		s.addGroup(group)
+	}
+}
+
+// AddMetricDefinitions adds metric definitions for all resources of a type.
+func (s *Server) AddMetricDefinitions(resourceType string, defs ...MetricDefinition) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strings.ToLower(resourceType)
+	s.definitions[key] = append(s.definitions[key], defs...)
+}
+
+// SetMetric sets the values returned for a metric of a resource.
+func (s *Server) SetMetric(resourceID string, m Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics[metricKey(resourceID, metricNamespace(resourceID, m.Namespace), m.Name)] = m
+}
+
+// SetAvailabilityStatus sets the current Resource Health status of a resource.
+func (s *Server) SetAvailabilityStatus(resourceID string, status AvailabilityStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.health[strings.ToLower(resourceID)] = status
+}
+
+// SetCosts sets the result of Cost Management queries for costs of a type, e.g.
+// ActualCost, in a scope such as /subscriptions/<id>.
+func (s *Server) SetCosts(scope, costType string, result CostResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.costs[strings.ToLower(scope+"|"+costType)] = result
+}
+
+// SetUsages sets the quota usages of a provider, e.g. Microsoft.Compute, in a location.
+func (s *Server) SetUsages(provider, location string, usages ...Usage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usages[strings.ToLower(provider+"|"+location)] = usages
+}
+
+// SetLogQueryResult sets the result of a query against a Log Analytics workspace.
+// Other queries fail.
+func (s *Server) SetLogQueryResult(workspaceID, query string, result LogQueryResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logQueries[strings.ToLower(workspaceID)+"|"+query] = result
+}
+
+// SetAppInsightsMetric sets the series of a metric of an Application Insights app.
+func (s *Server) SetAppInsightsMetric(appID, metricID string, series ...AppInsightsSeries) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.appMetrics[strings.ToLower(appID+"|"+metricID)] = series
+}
+
+// AddActivityLogEvents adds events to the Activity Log.
+func (s *Server) AddActivityLogEvents(events ...ActivityLogEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+}
+
+// SetAdvisorRecommendations sets the Advisor recommendations of the subscription.
+func (s *Server) SetAdvisorRecommendations(recommendations ...AdvisorRecommendation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advisor = recommendations
+}
+
+// SetSecureScores sets the secure scores of the subscription.
+func (s *Server) SetSecureScores(scores ...SecureScore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secureScores = scores
+}
+
+// Requests returns the path and query of all requests to the resource manager API so far.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// CountRequests returns the number of requests so far whose request URI contains substr.
+func (s *Server) CountRequests(substr string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, r := range s.requests {
+		if strings.Contains(r, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+// SetPageSize makes lists of resources and resource groups return at most n items per
+// page, with a nextLink to the next page. By default, all items are returned at once.
+func (s *Server) SetPageSize(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageSize = n
+}
+
+// TokenRequests returns the number of access tokens handed out so far.
+func (s *Server) TokenRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokenRequests
+}
+
+func metricKey(resourceID, namespace, metric string) string {
+	return strings.ToLower(resourceID + "|" + namespace + "|" + metric)
+}
+
+// metricNamespace returns the namespace of a metric of a resource, mapping the
+// default namespace named after the resource type to "".
+func metricNamespace(resourceID, namespace string) string {
+	if strings.EqualFold(namespace, resourceType(resourceID)) {
+		return ""
+	}
+	return strings.ToLower(namespace)
+}
+
+// segment returns the value following key in an ARM resource ID.
+func segment(id, key string) string {
+	parts := strings.Split(strings.Trim(id, "/"), "/")
+	for i := 0; i+1 < len(parts); i += 2 {
+		if strings.EqualFold(parts[i], key) {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+// resourceType returns the full type of an ARM resource ID, e.g. Microsoft.Sql/servers/databases.
+func resourceType(id string) string {
+	parts := strings.Split(strings.Trim(id, "/"), "/")
+	for i := 0; i+1 < len(parts); i += 2 {
+		if strings.EqualFold(parts[i], "providers") {
+			types := []string{parts[i+1]}
+			for j := i + 2; j+1 < len(parts); j += 2 {
+				types = append(types, parts[j])
+			}
+			return strings.Join(types, "/")
+		}
+	}
+	return ""
+}
+
+func resourceName(id string) string {
+	parts := strings.Split(strings.Trim(id, "/"), "/")
+	for i := 0; i+1 < len(parts); i += 2 {
+		if strings.EqualFold(parts[i], "providers") {
+			var names []string
+			for j := i + 3; j < len(parts); j += 2 {
+				names = append(names, parts[j])
+			}
+			return strings.Join(names, "/")
+		}
+	}
+	return ""
+}
+
+var (
+	tokenPath       = regexp.MustCompile(`^/[^/]+/oauth2/token$`)
+	groupsPath      = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/resourcegroups$`)
+	resourcesPath   = regexp.MustCompile(`(?i)^/subscriptions/[^/]+(/resourceGroups/([^/]+))?/resources$`)
+	definitionsPath = regexp.MustCompile(`(?i)^(/subscriptions/.+)/providers/microsoft\.insights/metricDefinitions$`)
+	metricsPath     = regexp.MustCompile(`(?i)^(/subscriptions/.+)/providers/microsoft\.insights/metrics$`)
+	costPath        = regexp.MustCompile(`(?i)^(/subscriptions/[^/]+(/resourceGroups/[^/]+)?)/providers/Microsoft\.CostManagement/query$`)
+	usagesPath      = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/providers/(Microsoft\.[^/]+)/locations/([^/]+)/usages$`)
+	namespacesPath  = regexp.MustCompile(`(?i)^(/subscriptions/.+)/providers/microsoft\.insights/metricNamespaces$`)
+	eventsPath      = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/providers/microsoft\.insights/eventtypes/management/values$`)
+	eventTimeFilter = regexp.MustCompile(`eventTimestamp (ge|le) '([^']+)'`)
+	advisorPath     = regexp.MustCompile(`(?i)^/subscriptions/([^/]+)/providers/Microsoft\.Advisor/recommendations$`)
+	secureScorePath = regexp.MustCompile(`(?i)^/subscriptions/([^/]+)/providers/Microsoft\.Security/secureScores$`)
+	healthPath      = regexp.MustCompile(`(?i)^(/subscriptions/.+)/providers/Microsoft\.ResourceHealth/availabilityStatuses/current$`)
+	logQueryPath    = regexp.MustCompile(`^/v1/workspaces/([^/]+)/query$`)
+	appMetricPath   = regexp.MustCompile(`^/v1/apps/([^/]+)/metrics/(.+)$`)
+	typeFilter      = regexp.MustCompile(`(?i)resourcetype eq '([^']+)'`)
+)
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if tokenPath.MatchString(r.URL.Path) {
+		s.handleToken(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, r.URL.RequestURI())
+	s.mu.Unlock()
+
+	token := AccessToken
+	if logQueryPath.MatchString(r.URL.Path) {
+		token = LogAnalyticsAccessToken
+	} else if appMetricPath.MatchString(r.URL.Path) {
+		token = AppInsightsAccessToken
+	}
+	if r.Header.Get("Authorization") != "Bearer "+token {
+		writeError(w, http.StatusUnauthorized, "InvalidAuthenticationToken", "missing or invalid access token")
+		return
+	}
+
+	switch path := r.URL.Path; {
+	case logQueryPath.MatchString(path):
+		s.handleLogQuery(w, r, logQueryPath.FindStringSubmatch(path)[1])
+	case appMetricPath.MatchString(path):
+		m := appMetricPath.FindStringSubmatch(path)
+		s.handleAppMetric(w, r, m[1], m[2])
+	case groupsPath.MatchString(path):
+		s.handleGroups(w, r)
+	case resourcesPath.MatchString(path):
+		s.handleResources(w, r, resourcesPath.FindStringSubmatch(path)[2])
+	case definitionsPath.MatchString(path):
+		s.handleDefinitions(w, r, definitionsPath.FindStringSubmatch(path)[1])
+	case namespacesPath.MatchString(path):
+		s.handleNamespaces(w, r, namespacesPath.FindStringSubmatch(path)[1])
+	case metricsPath.MatchString(path):
+		s.handleMetrics(w, r, metricsPath.FindStringSubmatch(path)[1])
+	case costPath.MatchString(path):
+		s.handleCost(w, r, costPath.FindStringSubmatch(path)[1])
+	case usagesPath.MatchString(path):
+		m := usagesPath.FindStringSubmatch(path)
+		s.handleUsages(w, m[1], m[2])
+	case eventsPath.MatchString(path):
+		s.handleEvents(w, r)
+	case advisorPath.MatchString(path):
+		s.handleAdvisor(w, advisorPath.FindStringSubmatch(path)[1])
+	case secureScorePath.MatchString(path):
+		s.handleSecureScores(w, secureScorePath.FindStringSubmatch(path)[1])
+	case healthPath.MatchString(path):
+		s.handleHealth(w, r, healthPath.FindStringSubmatch(path)[1])
+	default:
+		writeError(w, http.StatusNotFound, "NotFound", fmt.Sprintf("no fake for %s", path))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"code": code, "message": message},
+	})
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.FormValue("grant_type") != "client_credentials" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "expected a client credentials grant")
+		return
+	}
+
+	s.mu.Lock()
+	s.tokenRequests++
+	s.mu.Unlock()
+
+	token := AccessToken
+	switch r.FormValue("resource") {
+	case "https://api.loganalytics.io":
+		token = LogAnalyticsAccessToken
+	case "https://api.applicationinsights.io":
+		token = AppInsightsAccessToken
+	}
+
+	writeJSON(w, map[string]string{
+		"token_type":   "Bearer",
+		"access_token": token,
+		"expires_on":   fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix()),
+	})
+}
+
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value := []map[string]interface{}{}
+	for _, g := range s.groups {
+		value = append(value, map[string]interface{}{"name": g})
+	}
+	s.writePage(w, r, value)
+}
+
+func (s *Server) handleResources(w http.ResponseWriter, r *http.Request, group string) {
+	var types []string
+	for _, m := range typeFilter.FindAllStringSubmatch(r.URL.Query().Get("$filter"), -1) {
+		types = append(types, m[1])
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value := []map[string]interface{}{}
+	for _, res := range s.resources {
+		if group != "" && !strings.EqualFold(segment(res.ID, "resourceGroups"), group) {
+			continue
+		}
+		if len(types) > 0 {
+			matched := false
+			for _, t := range types {
+				matched = matched || strings.EqualFold(t, resourceType(res.ID))
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		item := map[string]interface{}{
+			"id":       res.ID,
+			"name":     resourceName(res.ID),
+			"type":     resourceType(res.ID),
+			"location": res.Location,
+			"tags":     res.Tags,
+		}
+		if res.Kind != "" {
+			item["kind"] = res.Kind
+		}
+		if res.Sku != "" {
+			item["sku"] = map[string]string{"name": res.Sku}
+		}
+		value = append(value, item)
+	}
+	s.writePage(w, r, value)
+}
+
+// writePage writes the page of value requested by the $skiptoken parameter. Callers must hold mu.
+func (s *Server) writePage(w http.ResponseWriter, r *http.Request, value []map[string]interface{}) {
+	query := r.URL.Query()
+	start := 0
+	if token := query.Get("$skiptoken"); token != "" {
+		n, err := strconv.Atoi(token)
+		if err != nil || n < 0 || n > len(value) {
+			writeError(w, http.StatusBadRequest, "InvalidSkipToken", fmt.Sprintf("invalid $skiptoken %s", token))
+			return
+		}
+		start = n
+	}
+
+	page := map[string]interface{}{"value": value[start:]}
+	if s.pageSize > 0 && len(value)-start > s.pageSize {
+		page["value"] = value[start : start+s.pageSize]
+		query.Set("$skiptoken", strconv.Itoa(start+s.pageSize))
+		page["nextLink"] = "https://management.azure.com" + r.URL.Path + "?" + query.Encode()
+	}
+	writeJSON(w, page)
+}
+
+func (s *Server) handleDefinitions(w http.ResponseWriter, r *http.Request, resourceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	namespace := metricNamespace(resourceID, r.URL.Query().Get("metricnamespace"))
+	value := []map[string]interface{}{}
+	for _, d := range s.definitions[strings.ToLower(resourceType(resourceID))] {
+		if metricNamespace(resourceID, d.Namespace) != namespace {
+			continue
+		}
+		var dims []map[string]string
+		for _, dim := range d.Dimensions {
+			dims = append(dims, map[string]string{"value": dim, "localizedValue": dim})
+		}
+		grains := d.TimeGrains
+		if len(grains) == 0 {
+			grains = []string{"PT1M"}
+		}
+		availabilities := []map[string]string{}
+		for _, g := range grains {
+			availabilities = append(availabilities, map[string]string{"timeGrain": g, "retention": "P93D"})
+		}
+		value = append(value, map[string]interface{}{
+			"id":                        resourceID + "/providers/microsoft.insights/metricdefinitions/" + d.Name,
+			"resourceId":                resourceID,
+			"name":                      map[string]string{"value": d.Name, "localizedValue": d.Name},
+			"unit":                      d.Unit,
+			"primaryAggregationType":    d.PrimaryAggregation,
+			"supportedAggregationTypes": []string{"None", "Average", "Minimum", "Maximum", "Total", "Count"},
+			"metricAvailabilities":      availabilities,
+			"dimensions":                dims,
+		})
+	}
+	writeJSON(w, map[string]interface{}{"value": value})
+}
+
+// timeGrains are the intervals accepted by the metrics API.
+var timeGrains = map[string]time.Duration{
+	"PT1M":  time.Minute,
+	"PT5M":  5 * time.Minute,
+	"PT15M": 15 * time.Minute,
+	"PT30M": 30 * time.Minute,
+	"PT1H":  time.Hour,
+	"PT6H":  6 * time.Hour,
+	"PT12H": 12 * time.Hour,
+	"P1D":   24 * time.Hour,
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request, resourceID string) {
+	query := r.URL.Query()
+	names := strings.Split(query.Get("metricnames"), ",")
+	if query.Get("metricnames") == "" {
+		writeError(w, http.StatusBadRequest, "BadRequest", "metricnames is required by this fake")
+		return
+	}
+	if len(names) > 20 {
+		writeError(w, http.StatusBadRequest, "BadRequest", "at most 20 metrics can be requested at once")
+		return
+	}
+
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = "PT1M"
+	}
+	grain, ok := timeGrains[strings.ToUpper(interval)]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BadRequest", fmt.Sprintf("Invalid interval: %s", interval))
+		return
+	}
+	// Without a timespan, Azure returns the last hour.
+	end := time.Now().UTC().Truncate(grain)
+	grains := int(time.Hour / grain)
+	if grains < 1 {
+		grains = 1
+	}
+	if timespan := query.Get("timespan"); timespan != "" {
+		var from, to time.Time
+		parts := strings.Split(timespan, "/")
+		var err error
+		if len(parts) == 2 {
+			if from, err = time.Parse(time.RFC3339, parts[0]); err == nil {
+				to, err = time.Parse(time.RFC3339, parts[1])
+			}
+		}
+		if len(parts) != 2 || err != nil || !from.Before(to) {
+			writeError(w, http.StatusBadRequest, "BadRequest", fmt.Sprintf("Invalid timespan: %s", timespan))
+			return
+		}
+		end = to.UTC().Truncate(grain)
+		grains = int(to.Sub(from) / grain)
+		if grains < 1 {
+			grains = 1
+		}
+	}
+
+	namespace := metricNamespace(resourceID, query.Get("metricnamespace"))
+	aggregations := make(map[string]bool)
+	for _, a := range strings.Split(query.Get("aggregation"), ",") {
+		aggregations[strings.ToLower(a)] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value := []map[string]interface{}{}
+	for _, name := range names {
+		m, ok := s.metrics[metricKey(resourceID, namespace, name)]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "BadRequest", fmt.Sprintf("Failed to find metric configuration for provider, metric: %s", name))
+			return
+		}
+
+		timeseries := []map[string]interface{}{}
+		for _, ts := range m.Timeseries {
+			// The configured data points are the latest ones in the timespan, with
+			// older ones falling out of it.
+			points := ts.Data
+			if len(points) > grains {
+				points = points[len(points)-grains:]
+			}
+			data := []map[string]interface{}{}
+			start := end.Add(-time.Duration(len(points)) * grain)
+			for i, point := range points {
+				item := map[string]interface{}{"timeStamp": start.Add(time.Duration(i) * grain).Format(time.RFC3339)}
+				for k, v := range point {
+					if aggregations[k] {
+						item[k] = v
+					}
+				}
+				data = append(data, item)
+			}
+
+			var metadata []map[string]interface{}
+			for k, v := range ts.Metadata {
+				metadata = append(metadata, map[string]interface{}{
+					"name":  map[string]string{"value": k, "localizedValue": k},
+					"value": v,
+				})
+			}
+			item := map[string]interface{}{"data": data}
+			if metadata != nil {
+				item["metadatavalues"] = metadata
+			}
+			timeseries = append(timeseries, item)
+		}
+
+		value = append(value, map[string]interface{}{
+			"id":         resourceID + "/providers/Microsoft.Insights/metrics/" + m.Name,
+			"type":       "Microsoft.Insights/metrics",
+			"name":       map[string]string{"value": m.Name, "localizedValue": m.Name},
+			"unit":       m.Unit,
+			"timeseries": timeseries,
+		})
+	}
+	writeJSON(w, map[string]interface{}{
+		"timespan": query.Get("timespan"),
+		"interval": interval,
+		"value":    value,
+	})
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request, resourceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.health[strings.ToLower(resourceID)]
+	if !ok {
+		status = AvailabilityStatus{State: "Unknown", Summary: "We are currently unable to determine the health of this resource."}
+	}
+	writeJSON(w, map[string]interface{}{
+		"id":   resourceID + "/providers/Microsoft.ResourceHealth/availabilityStatuses/current",
+		"name": "current",
+		"type": "Microsoft.ResourceHealth/AvailabilityStatuses",
+		"properties": map[string]string{
+			"availabilityState": status.State,
+			"summary":           status.Summary,
+			"reasonType":        status.ReasonType,
+			"occuredTime":       time.Now().UTC().Format(time.RFC3339),
+		},
+	})
+}
+
+func (s *Server) handleCost(w http.ResponseWriter, r *http.Request, scope string) {
+	var query struct {
+		Type string `json:"type"`
+	}
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&query) != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", "expected a POST request with a query")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := s.costs[strings.ToLower(scope+"|"+query.Type)]
+	columns := []map[string]string{}
+	for i, name := range result.Columns {
+		columnType := "String"
+		if len(result.Rows) > 0 && i < len(result.Rows[0]) {
+			if _, ok := result.Rows[0][i].(float64); ok {
+				columnType = "Number"
+			}
+		}
+		columns = append(columns, map[string]string{"name": name, "type": columnType})
+	}
+	rows := result.Rows
+	if rows == nil {
+		rows = [][]interface{}{}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"id":   scope + "/providers/Microsoft.CostManagement/query/" + query.Type,
+		"type": "Microsoft.CostManagement/query",
+		"properties": map[string]interface{}{
+			"nextLink": nil,
+			"columns":  columns,
+			"rows":     rows,
+		},
+	})
+}
+
+func (s *Server) handleUsages(w http.ResponseWriter, provider, location string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value := []map[string]interface{}{}
+	for _, u := range s.usages[strings.ToLower(provider+"|"+location)] {
+		value = append(value, map[string]interface{}{
+			"name":         map[string]string{"value": u.Name, "localizedValue": u.Name},
+			"unit":         u.Unit,
+			"currentValue": u.CurrentValue,
+			"limit":        u.Limit,
+		})
+	}
+	writeJSON(w, map[string]interface{}{"value": value})
+}
+
+func (s *Server) handleLogQuery(w http.ResponseWriter, r *http.Request, workspaceID string) {
+	var query struct {
+		Query    string `json:"query"`
+		Timespan string `json:"timespan"`
+	}
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&query) != nil {
+		writeError(w, http.StatusBadRequest, "BadArgumentError", "expected a POST request with a query")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, ok := s.logQueries[strings.ToLower(workspaceID)+"|"+query.Query]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BadArgumentError", fmt.Sprintf("no fake for query %q", query.Query))
+		return
+	}
+
+	columns := []map[string]string{}
+	for i, name := range result.Columns {
+		columnType := "string"
+		if len(result.Rows) > 0 && i < len(result.Rows[0]) {
+			if _, ok := result.Rows[0][i].(float64); ok {
+				columnType = "real"
+			}
+		}
+		columns = append(columns, map[string]string{"name": name, "type": columnType})
+	}
+	rows := result.Rows
+	if rows == nil {
+		rows = [][]interface{}{}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"tables": []map[string]interface{}{
+			{"name": "PrimaryResult", "columns": columns, "rows": rows},
+		},
+	})
+}
+
+func (s *Server) handleAppMetric(w http.ResponseWriter, r *http.Request, appID, metricID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	series, ok := s.appMetrics[strings.ToLower(appID+"|"+metricID)]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BadArgumentError", fmt.Sprintf("metric %s is unknown", metricID))
+		return
+	}
+
+	var segments, aggregations []string
+	if segment := r.URL.Query().Get("segment"); segment != "" {
+		segments = strings.Split(segment, ",")
+	}
+	if aggregation := r.URL.Query().Get("aggregation"); aggregation != "" {
+		aggregations = strings.Split(aggregation, ",")
+	}
+
+	value := appMetricSegment(metricID, series, segments, aggregations)
+	value["start"] = time.Now().Add(-4 * time.Minute).UTC().Format(time.RFC3339)
+	value["end"] = time.Now().Add(-3 * time.Minute).UTC().Format(time.RFC3339)
+	writeJSON(w, map[string]interface{}{"value": value})
+}
+
+// appMetricSegment returns the result for series split by segments, nesting the
+// segments in the order they were requested like Application Insights does.
+func appMetricSegment(metricID string, series []AppInsightsSeries, segments []string, aggregations []string) map[string]interface{} {
+	if len(segments) == 0 {
+		values := make(map[string]float64)
+		for _, a := range aggregations {
+			n := 0
+			for _, s := range series {
+				v, ok := s.Values[a]
+				if !ok {
+					continue
+				}
+				current := values[a]
+				switch {
+				case n == 0:
+					values[a] = v
+				case a == "sum":
+					values[a] = current + v
+				case a == "avg":
+					values[a] = (current*float64(n) + v) / float64(n+1)
+				case a == "min" && v < current, a == "max" && v > current:
+					values[a] = v
+				}
+				n++
+			}
+		}
+		return map[string]interface{}{metricID: values}
+	}
+
+	var order []string
+	groups := make(map[string][]AppInsightsSeries)
+	for _, s := range series {
+		v := s.Segments[segments[0]]
+		if _, ok := groups[v]; !ok {
+			order = append(order, v)
+		}
+		groups[v] = append(groups[v], s)
+	}
+
+	var nested []map[string]interface{}
+	for _, v := range order {
+		segment := appMetricSegment(metricID, groups[v], segments[1:], aggregations)
+		if v != "" {
+			segment[segments[0]] = v
+		}
+		nested = append(nested, segment)
+	}
+	return map[string]interface{}{"segments": nested}
+}
+
+func (s *Server) handleNamespaces(w http.ResponseWriter, r *http.Request, resourceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	namespaces := []string{resourceType(resourceID)}
+	seen := map[string]bool{"": true}
+	for _, d := range s.definitions[strings.ToLower(resourceType(resourceID))] {
+		if ns := metricNamespace(resourceID, d.Namespace); !seen[ns] {
+			seen[ns] = true
+			namespaces = append(namespaces, d.Namespace)
+		}
+	}
+
+	value := []map[string]interface{}{}
+	for i, ns := range namespaces {
+		classification := "Custom"
+		if i == 0 {
+			classification = "Platform"
+		}
+		value = append(value, map[string]interface{}{
+			"id":             resourceID + "/providers/microsoft.insights/metricNamespaces/" + ns,
+			"name":           ns,
+			"type":           "Microsoft.Insights/metricNamespaces",
+			"classification": classification,
+			"properties":     map[string]string{"metricNamespaceName": ns},
+		})
+	}
+	writeJSON(w, map[string]interface{}{"value": value})
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	// Like Azure, only the time range of the filter is required; other conditions are ignored by this fake.
+	var from, to time.Time
+	for _, m := range eventTimeFilter.FindAllStringSubmatch(r.URL.Query().Get("$filter"), -1) {
+		t, err := time.Parse(time.RFC3339, m[2])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BadRequest", fmt.Sprintf("invalid time %s", m[2]))
+			return
+		}
+		if m[1] == "ge" {
+			from = t
+		} else {
+			to = t
+		}
+	}
+	if from.IsZero() || to.IsZero() {
+		writeError(w, http.StatusBadRequest, "BadRequest", "the filter must contain an eventTimestamp range")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value := []map[string]interface{}{}
+	for _, e := range s.events {
+		if e.Timestamp.Before(from) || e.Timestamp.After(to) {
+			continue
+		}
+		value = append(value, map[string]interface{}{
+			"eventDataId":    e.ID,
+			"eventTimestamp": e.Timestamp.UTC().Format(time.RFC3339Nano),
+			"operationName":  map[string]string{"value": e.OperationName, "localizedValue": e.OperationName},
+			"status":         map[string]string{"value": e.Status, "localizedValue": e.Status},
+			"resourceType":   map[string]string{"value": e.ResourceType, "localizedValue": e.ResourceType},
+			"category":       map[string]string{"value": e.Category, "localizedValue": e.Category},
+			"caller":         e.Caller,
+			"claims":         e.Claims,
+		})
+	}
+	writeJSON(w, map[string]interface{}{"value": value})
+}
+
+func (s *Server) handleAdvisor(w http.ResponseWriter, subscriptionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value := []map[string]interface{}{}
+	for i, r := range s.advisor {
+		name := fmt.Sprintf("recommendation-%d", i)
+		value = append(value, map[string]interface{}{
+			"id":   "/subscriptions/" + subscriptionID + "/providers/Microsoft.Advisor/recommendations/" + name,
+			"name": name,
+			"type": "Microsoft.Advisor/recommendations",
+			"properties": map[string]interface{}{
+				"category":         r.Category,
+				"impact":           r.Impact,
+				"shortDescription": map[string]string{"problem": r.Problem, "solution": r.Problem},
+			},
+		})
+	}
+	writeJSON(w, map[string]interface{}{"value": value})
+}
+
+func (s *Server) handleSecureScores(w http.ResponseWriter, subscriptionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value := []map[string]interface{}{}
+	for _, score := range s.secureScores {
+		percentage := 0.0
+		if score.Max > 0 {
+			percentage = score.Current / score.Max
+		}
+		value = append(value, map[string]interface{}{
+			"id":   "/subscriptions/" + subscriptionID + "/providers/Microsoft.Security/secureScores/" + score.Name,
+			"name": score.Name,
+			"type": "Microsoft.Security/secureScores",
+			"properties": map[string]interface{}{
+				"displayName": score.Name,
+				"score":       map[string]float64{"max": score.Max, "current": score.Current, "percentage": percentage},
+				"weight":      score.Max,
+			},
+		})
+	}
+	writeJSON(w, map[string]interface{}{"value": value})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/credativ/azure_metrics_exporter/config"
+	"github.com/credativ/azure_metrics_exporter/exporter"
+)
+
+// hasMetric reports whether a metric of the given name is among the definitions.
+func hasMetric(definitions []exporter.AzureMetricDefinitionResponse, metric string) bool {
+	for _, def := range definitions {
+		for _, d := range def.MetricDefinitionResponses {
+			if strings.EqualFold(d.Name.Value, metric) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkMetricNames verifies the configured metric names against the metric
+// definitions of the configured resources. For resource groups, the definitions
+// of one resource of each matching type are used.
+func checkMetricNames(cfg *config.Config, client exporter.AzureAPI) []error {
+	var errs []error
+
+	for i, target := range cfg.Resources {
+		p := config.Path{"resources", i}
+		resourceID, err := exporter.ParseResourceID(fmt.Sprintf("/subscriptions/%s%s", cfg.Credentials.SubscriptionID, target.Name))
+		if err != nil {
+			errs = append(errs, cfg.ErrorAt(p.Key("name"), "%v", err))
+			continue
+		}
+		def, err := client.GetMetricDefinitions(resourceID, target.Namespace)
+		if err != nil {
+			errs = append(errs, cfg.ErrorAt(p.Key("name"), "failed to get metric definitions: %v", err))
+			continue
+		}
+
+		if target.Metrics.All() {
+			continue
+		}
+		for j, metric := range target.Metrics {
+			if !hasMetric([]exporter.AzureMetricDefinitionResponse{def}, metric) {
+				errs = append(errs, cfg.ErrorAt(p.Key("metrics").Index(j), "metric %q is not defined for this resource", metric))
+			}
+		}
+	}
+
+	for i, target := range cfg.ResourceGroups {
+		p := config.Path{"resource_groups", i}
+		if target.Metrics.All() {
+			continue
+		}
+		resources, err := exporter.ListResourceGroupTargets(client, target)
+		if err != nil {
+			errs = append(errs, cfg.ErrorAt(p.Key("name"), "failed to list resources: %v", err))
+			continue
+		}
+		if len(resources) == 0 {
+			// Nothing to check the metrics against.
+			continue
+		}
+
+		var definitions []exporter.AzureMetricDefinitionResponse
+		seenTypes := make(map[string]bool)
+		for _, resource := range resources {
+			resourceID, err := exporter.ParseResourceID(resource.Id)
+			if err != nil {
+				continue
+			}
+			resourceType := strings.ToLower(resourceID.ResourceType)
+			if seenTypes[resourceType] {
+				continue
+			}
+			seenTypes[resourceType] = true
+
+			def, err := client.GetMetricDefinitions(resourceID, target.Namespace)
+			if err != nil {
+				errs = append(errs, cfg.ErrorAt(p.Key("name"), "failed to get metric definitions of %s: %v", resource.Id, err))
+				continue
+			}
+			definitions = append(definitions, def)
+		}
+
+		for j, metric := range target.Metrics {
+			if len(definitions) > 0 && !hasMetric(definitions, metric) {
+				errs = append(errs, cfg.ErrorAt(p.Key("metrics").Index(j), "metric %q is not defined for any of the selected resource types", metric))
+			}
+		}
+	}
+
+	return errs
+}
+
+// checkConfig validates the config file, reports all problems and exits.
+// Metric names are checked against the Azure API when it can be reached.
+func checkConfig() {
+	cfg, err := config.LoadConfig(*configFile)
+	if errs, ok := err.(config.ValidationErrors); ok {
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", *configFile, e)
+		}
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Fixtures are redacted using the credentials of the current config.
+	sc.Lock()
+	sc.C = cfg
+	sc.Unlock()
+
+	client := exporter.NewAzureClient(cfg.Credentials, httpClient)
+	if _, err := client.RefreshAccessToken(); err != nil {
+		fmt.Fprintf(os.Stderr, "Skipping check of metric names: %v\n", err)
+	} else if errs := checkMetricNames(cfg, client); len(errs) > 0 {
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", *configFile, e)
+		}
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s: config is valid\n", *configFile)
+	os.Exit(0)
+}
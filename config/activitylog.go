@@ -0,0 +1,33 @@
+package config
+
+import (
+	"time"
+)
+
+// ActivityLog - the Activity Log events counted by operation, status, resource type
+// and category.
+type ActivityLog struct {
+	// Filter is an OData filter the events are additionally restricted by, e.g.
+	// "resourceGroupName eq 'web'".
+	Filter string `yaml:"filter"`
+	// StateFile is where the time up to which events were counted is kept, so events
+	// are neither missed nor counted twice across restarts.
+	StateFile string `yaml:"state_file"`
+	// Interval is the minimum time between two queries of the Activity Log, 1m by default.
+	Interval time.Duration `yaml:"interval"`
+
+	XXX map[string]interface{} `yaml:",inline"`
+}
+
+const defaultActivityLogInterval = time.Minute
+
+// validateActivityLog checks the Activity Log settings and fills in their defaults.
+func (v *validator) validateActivityLog(a *ActivityLog, p Path) {
+	v.checkOverflow(a.XXX, p)
+
+	if a.Interval == 0 {
+		a.Interval = defaultActivityLogInterval
+	} else if a.Interval < 0 {
+		v.errorf(p.Key("interval"), "interval must not be negative")
+	}
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"time"
+)
+
+// Advisor - exports the open Azure Advisor recommendations of the subscription.
+type Advisor struct {
+	// Interval is how long recommendations are cached, 1h by default.
+	Interval time.Duration `yaml:"interval"`
+
+	XXX map[string]interface{} `yaml:",inline"`
+}
+
+// SecureScore - exports the Defender for Cloud secure scores of the subscription.
+type SecureScore struct {
+	// Interval is how long scores are cached, 1h by default.
+	Interval time.Duration `yaml:"interval"`
+
+	XXX map[string]interface{} `yaml:",inline"`
+}
+
+// Advisor recommendations and secure scores change slowly, so they are not queried on every scrape.
+const defaultSlowInterval = time.Hour
+
+// validateSlowInterval checks the interval of a slowly changing API and fills in its default.
+func (v *validator) validateSlowInterval(interval *time.Duration, p Path) {
+	if *interval == 0 {
+		*interval = defaultSlowInterval
+	} else if *interval < 0 {
+		v.errorf(p.Key("interval"), "interval must not be negative")
+	}
+}
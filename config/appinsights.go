@@ -0,0 +1,57 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// AppInsights - an Application Insights component whose metrics are queried from the
+// Application Insights metrics API, which unlike the resource manager API also serves
+// custom metrics.
+type AppInsights struct {
+	// Name is the resource path of the component, like the name of resources.
+	Name string `yaml:"name"`
+	// AppID is the Application ID shown in the API Access settings of the component.
+	AppID        string   `yaml:"app_id"`
+	Metrics      []string `yaml:"metrics"`
+	Aggregations []string `yaml:"aggregations"`
+	// Segments are the dimensions metrics are split by, e.g. request/resultCode.
+	Segments []string `yaml:"segments"`
+
+	XXX map[string]interface{} `yaml:",inline"`
+}
+
+// validateAppInsights checks an Application Insights component. segments are the segments
+// metrics of the components validated before are split by, by lowercased metric ID.
+func (v *validator) validateAppInsights(a *AppInsights, segments map[string][]string, p Path) {
+	v.checkOverflow(a.XXX, p)
+	v.validateResourceName(a.Name, p)
+
+	if strings.TrimSpace(a.AppID) == "" {
+		v.errorf(p.Key("app_id"), "app_id needs to be specified")
+	}
+
+	v.validateMetrics(a.Metrics, a.Aggregations, p)
+	for i, s := range a.Segments {
+		if strings.TrimSpace(s) == "" {
+			v.errorf(p.Key("segments").Index(i), "segment must not be empty")
+		}
+	}
+
+	// The segments are exported as labels, which need to be the same for all series of a metric.
+	var sorted []string
+	for _, s := range a.Segments {
+		sorted = append(sorted, strings.ToLower(s))
+	}
+	sort.Strings(sorted)
+	for i, metric := range a.Metrics {
+		other, ok := segments[strings.ToLower(metric)]
+		if !ok {
+			segments[strings.ToLower(metric)] = sorted
+			continue
+		}
+		if strings.Join(other, ",") != strings.Join(sorted, ",") {
+			v.errorf(p.Key("metrics").Index(i), "metric %s is already collected with the segments %v, the same ones need to be used", metric, other)
+		}
+	}
+}
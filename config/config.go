@@ -3,7 +3,10 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"path"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 
@@ -15,9 +18,31 @@ type Config struct {
 	Credentials    Credentials     `yaml:"credentials"`
 	Resources      []Resource      `yaml:"resources"`
 	ResourceGroups []ResourceGroup `yaml:"resource_groups"`
+	// TagLabels maps Azure resource tag names to the label names they are exported as.
+	TagLabels map[string]string `yaml:"tag_labels"`
+	// Modules are named metric selections used by the /probe endpoint.
+	Modules map[string]Module `yaml:"modules"`
+	// Costs are Cost Management queries whose results are exported.
+	Costs []Cost `yaml:"costs"`
+	// AppInsights are Application Insights components whose metrics are queried from
+	// the Application Insights API.
+	AppInsights []AppInsights `yaml:"app_insights"`
+	// LogQueries are Log Analytics queries whose results are exported.
+	LogQueries []LogQuery `yaml:"log_queries"`
+	// ActivityLog enables counting Activity Log events.
+	ActivityLog *ActivityLog `yaml:"activity_log"`
+	// Advisor enables exporting Azure Advisor recommendations.
+	Advisor *Advisor `yaml:"advisor"`
+	// SecureScore enables exporting Defender for Cloud secure scores.
+	SecureScore *SecureScore `yaml:"secure_score"`
+	// Quotas enables exporting the usage and limits of subscription quotas.
+	Quotas *Quotas `yaml:"quotas"`
 
 	// Catches all undefined fields and must be empty after parsing.
 	XXX map[string]interface{} `yaml:",inline"`
+
+	// The raw config file, used to locate validation errors.
+	source []byte
 }
 
 // SafeConfig - mutex protected config for live reloads.
@@ -26,93 +51,412 @@ type SafeConfig struct {
 	C *Config
 }
 
-// ReloadConfig - allows for live reloads of the configuration file.
-func (sc *SafeConfig) ReloadConfig(confFile string) (err error) {
+// Get - returns the current configuration. Reloads replace the configuration as a
+// whole, so the returned value stays consistent and must not be modified.
+func (sc *SafeConfig) Get() *Config {
+	sc.RLock()
+	defer sc.RUnlock()
+	return sc.C
+}
+
+// LoadConfig - reads, parses and validates a configuration file.
+// Validation problems are returned as ValidationErrors.
+func LoadConfig(confFile string) (*Config, error) {
 	var c = &Config{}
 
 	yamlFile, err := ioutil.ReadFile(confFile)
 	if err != nil {
-		return fmt.Errorf("Error reading config file: %s", err)
+		return nil, fmt.Errorf("Error reading config file: %s", err)
 	}
 
 	if err := yaml.Unmarshal(yamlFile, c); err != nil {
-		return fmt.Errorf("Error parsing config file: %s", err)
+		return nil, fmt.Errorf("Error parsing config file: %s", err)
+	}
+	c.source = yamlFile
+
+	if err := c.Credentials.loadSecretFile(filepath.Dir(confFile)); err != nil {
+		return nil, fmt.Errorf("Error reading client secret file: %s", err)
 	}
 
 	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// ReloadConfig - allows for live reloads of the configuration file. If swap is not nil,
+// it is called with the new configuration before it replaces the current one, while the
+// lock is held, so that state depending on the configuration can be replaced at once.
+func (sc *SafeConfig) ReloadConfig(confFile string, swap func(c *Config)) (err error) {
+	c, err := LoadConfig(confFile)
+	if _, ok := err.(ValidationErrors); ok {
 		return fmt.Errorf("Error validating config file: %s", err)
 	}
+	if err != nil {
+		return err
+	}
 
 	sc.Lock()
+	if swap != nil {
+		swap(c)
+	}
 	sc.C = c
 	sc.Unlock()
 
 	return nil
 }
 
+// ReferencedFiles - returns all files besides the config file itself that the configuration was read from.
+func (c *Config) ReferencedFiles() []string {
+	var files []string
+	if c.Credentials.ClientSecretFile != "" {
+		files = append(files, c.Credentials.ClientSecretFile)
+	}
+	return files
+}
+
 var validAggregations = []string{"Total", "Average", "Minimum", "Maximum"}
 
-func (c *Config) validateAggregations(aggregations []string) error {
-	for _, a := range aggregations {
-		ok := false
-		for _, valid := range validAggregations {
-			if a == valid {
-				ok = true
-				break
-			}
+func validateAggregation(a string) error {
+	for _, valid := range validAggregations {
+		if a == valid {
+			return nil
 		}
-		if !ok {
-			return fmt.Errorf("%s is not one of the valid aggregations (%v)", a, validAggregations)
+	}
+	return fmt.Errorf("%s is not one of the valid aggregations (%v)", a, validAggregations)
+}
+
+func validateAggregations(aggregations []string) error {
+	for _, a := range aggregations {
+		if err := validateAggregation(a); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (c *Config) Validate() (err error) {
-	for _, t := range c.Resources {
-		if err := c.validateAggregations(t.Aggregations); err != nil {
-			return err
-		}
+var (
+	validLabelName = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
 
-		if len(t.Name) == 0 {
-			return fmt.Errorf("name needs to be specified in each resource")
-		}
+	// Labels set by the exporter itself, which tags must not be mapped to.
+	reservedLabels = []string{"resource_id", "subscription_id", "resource_group", "resource_type", "resource_name", "location", "sku", "kind", "metric"}
+	// Labels of metric dimensions are prefixed with this.
+	dimensionLabelPrefix = "dimension_"
 
-		if !strings.HasPrefix(t.Name, "/") {
-			return fmt.Errorf("Resource path %q must start with a /", t.Name)
+	// Resource names are relative to the subscription and must name a resource, not a group.
+	validResourceName = regexp.MustCompile("(?i)^/resourceGroups/[^/]+/providers/[^/]+(/[^/]+/[^/]+)+$")
+)
+
+func (v *validator) validateTagLabels(tagLabels map[string]string, p Path) {
+	var tags []string
+	for tag := range tagLabels {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	seen := make(map[string]string)
+	for _, tag := range tags {
+		label := tagLabels[tag]
+		if !validLabelName.MatchString(label) {
+			v.errorf(p.Key(tag), "label name %q is not a valid Prometheus label name", label)
+		}
+		for _, reserved := range reservedLabels {
+			if label == reserved {
+				v.errorf(p.Key(tag), "label name %q is reserved", label)
+			}
 		}
+		if strings.HasPrefix(label, dimensionLabelPrefix) {
+			v.errorf(p.Key(tag), "label names starting with %q are reserved for metric dimensions", dimensionLabelPrefix)
+		}
+		if other, ok := seen[label]; ok {
+			v.errorf(p.Key(tag), "tag %q is already mapped to label %q", other, label)
+		}
+		seen[label] = tag
+	}
+}
 
-		if len(t.Metrics) == 0 {
-			return fmt.Errorf("At least one metric needs to be specified in each resource")
+func (v *validator) validateMetrics(metrics []string, aggregations []string, p Path) {
+	if len(metrics) == 0 {
+		v.errorf(p.Key("metrics"), "at least one metric needs to be specified")
+	}
+	for i, m := range metrics {
+		if strings.TrimSpace(m) == "" {
+			v.errorf(p.Key("metrics").Index(i), "metric name must not be empty")
 		}
 	}
+	for i, a := range aggregations {
+		if err := validateAggregation(a); err != nil {
+			v.errorf(p.Key("aggregations").Index(i), "%s", err)
+		}
+	}
+}
 
-	for _, t := range c.ResourceGroups {
-		if err := c.validateAggregations(t.Aggregations); err != nil {
-			return err
+func (v *validator) validateCredentials(c *Credentials, p Path) {
+	v.checkOverflow(c.XXX, p)
+
+	required := []struct {
+		key, value string
+	}{
+		{"subscription_id", c.SubscriptionID},
+		{"tenant_id", c.TenantID},
+		{"client_id", c.ClientID},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			v.errorf(p.Key(r.key), "%s needs to be specified", r.key)
 		}
+	}
+	if c.ClientSecret == "" && c.ClientSecretFile == "" {
+		v.errorf(p.Key("client_secret"), "one of client_secret and client_secret_file needs to be specified")
+	}
+}
+
+// validateResourceName checks the name of a resource relative to the subscription.
+func (v *validator) validateResourceName(name string, p Path) {
+	if len(name) == 0 {
+		v.errorf(p.Key("name"), "name needs to be specified in each resource")
+	} else if !strings.HasPrefix(name, "/") {
+		v.errorf(p.Key("name"), "resource path %q must start with a /", name)
+	} else if !validResourceName.MatchString(name) {
+		v.errorf(p.Key("name"), "resource path %q must have the form /resourceGroups/<group>/providers/<namespace>/<type>/<name>", name)
+	}
+}
+
+func (v *validator) validateResource(t *Resource, p Path) {
+	v.checkOverflow(t.XXX, p)
+	v.validateResourceName(t.Name, p)
+	v.validateMetrics(t.Metrics, t.Aggregations, p)
+	v.validateMetricFilter(t.Metrics, t.MetricInclude, t.MetricExclude, p)
+	t.compileFilters(v, p)
+	v.validateNullPolicies(t.NullPolicy, t.MetricNullPolicies, p)
+}
+
+// compileFilters compiles the regexps of the entry, reporting invalid ones to v.
+func (t *Resource) compileFilters(v *validator, p Path) {
+	errs := len(v.errs)
+	t.metricFilter = v.compileMetricFilter(t.MetricInclude, t.MetricExclude, p)
+	t.filtersValid = len(v.errs) == errs
+}
+
+// Compile - compiles the regexps of the entry. Validate does this for loaded configs,
+// entries built in code need to be compiled once before use.
+func (t *Resource) Compile() error {
+	v := &validator{}
+	t.compileFilters(v, nil)
+	return v.result()
+}
 
-		if len(t.Name) == 0 {
-			return fmt.Errorf("name needs to be specified in each resource group")
+func (v *validator) validateResourceGroup(t *ResourceGroup, p Path) {
+	v.checkOverflow(t.XXX, p)
+
+	switch {
+	case t.Name == "" && t.NameRegexp == "":
+		v.errorf(p.Key("name"), "one of name and name_regexp needs to be specified in each resource group")
+	case t.Name != "" && t.NameRegexp != "":
+		v.errorf(p.Key("name_regexp"), "only one of name and name_regexp may be specified")
+	case t.NameRegexp != "":
+		// Compiled by compileFilters.
+	default:
+		if _, err := path.Match(t.Name, ""); err != nil {
+			v.errorf(p.Key("name"), "invalid pattern %q: %s", t.Name, err)
 		}
+	}
 
-		if len(t.Name) == 0 {
-			return fmt.Errorf("At lease one resource type needs to be specified in each resource group")
+	if len(t.ResourceTypes) == 0 {
+		v.errorf(p.Key("resource_types"), "at least one resource type needs to be specified in each resource group")
+	}
+	for i, rt := range t.ResourceTypes {
+		if !strings.Contains(rt, "/") {
+			v.errorf(p.Key("resource_types").Index(i), "resource type %q must have the form <namespace>/<type>", rt)
 		}
+	}
+
+	v.validateMetrics(t.Metrics, t.Aggregations, p)
+	v.validateMetricFilter(t.Metrics, t.MetricInclude, t.MetricExclude, p)
+	v.validateNullPolicies(t.NullPolicy, t.MetricNullPolicies, p)
+
+	for i := range t.IncludeFilters {
+		v.validateResourceFilter(&t.IncludeFilters[i], p.Key("include_filters").Index(i))
+	}
+	for i := range t.ExcludeFilters {
+		v.validateResourceFilter(&t.ExcludeFilters[i], p.Key("exclude_filters").Index(i))
+	}
+	t.compileFilters(v, p)
+}
+
+// compileFilters compiles the regexps of the entry, reporting invalid ones to v.
+func (t *ResourceGroup) compileFilters(v *validator, p Path) {
+	errs := len(v.errs)
+	t.nameRegexp = v.compile(t.NameRegexp, true, p.Key("name_regexp"))
+	t.metricFilter = v.compileMetricFilter(t.MetricInclude, t.MetricExclude, p)
+	t.resourceInclude = v.compileAll(t.ResourceInclude, p.Key("resource_include"))
+	t.resourceExclude = v.compileAll(t.ResourceExclude, p.Key("resource_exclude"))
+	for i := range t.IncludeFilters {
+		t.IncludeFilters[i].compile(v, p.Key("include_filters").Index(i))
+	}
+	for i := range t.ExcludeFilters {
+		t.ExcludeFilters[i].compile(v, p.Key("exclude_filters").Index(i))
+	}
+	t.filtersValid = len(v.errs) == errs
+}
+
+// Compile - compiles the regexps of the entry. Validate does this for loaded configs,
+// entries built in code need to be compiled once before use.
+func (t *ResourceGroup) Compile() error {
+	v := &validator{}
+	t.compileFilters(v, nil)
+	return v.result()
+}
 
-		if len(t.Metrics) == 0 {
-			return fmt.Errorf("At least one metric needs to be specified in each resource group")
+// compile returns the compiled regexp, or nil if it is empty or invalid.
+func (v *validator) compile(rx string, ignoreCase bool, p Path) *regexp.Regexp {
+	if rx == "" {
+		return nil
+	}
+	expr := rx
+	if ignoreCase {
+		expr = "(?i)" + rx
+	}
+	compiled, err := regexp.Compile(expr)
+	if err != nil {
+		v.errorf(p, "error in regexp %q: %s", rx, err)
+		return nil
+	}
+	return compiled
+}
+
+func (v *validator) compileAll(regexps []string, p Path) []*regexp.Regexp {
+	var compiled []*regexp.Regexp
+	for i, rx := range regexps {
+		if rx == "" {
+			v.errorf(p.Index(i), "regexp must not be empty")
+			continue
+		}
+		if c := v.compile(rx, false, p.Index(i)); c != nil {
+			compiled = append(compiled, c)
 		}
+	}
+	return compiled
+}
 
-		for _, rx := range append(t.ResourceInclude, t.ResourceExclude...) {
-			if _, err := regexp.Compile(rx); err != nil {
-				return fmt.Errorf("Error in regexp '%s': %s", rx, err)
-			}
+func (v *validator) validateResourceFilter(f *ResourceFilter, p Path) {
+	v.checkOverflow(f.XXX, p)
+
+	if f.ID == "" && f.Name == "" && f.Type == "" && f.Location == "" && len(f.Tags) == 0 {
+		v.errorf(p, "at least one of id, name, type, location or tags needs to be specified")
+	}
+}
+
+// compile compiles the regexps of the filter, reporting invalid ones to v.
+func (f *ResourceFilter) compile(v *validator, p Path) {
+	// Azure treats IDs, types and locations case-insensitively.
+	f.id = v.compile(f.ID, true, p.Key("id"))
+	f.name = v.compile(f.Name, false, p.Key("name"))
+	f.resourceType = v.compile(f.Type, true, p.Key("type"))
+	f.location = v.compile(f.Location, true, p.Key("location"))
+
+	f.tags = make(map[string]*regexp.Regexp)
+	var tags []string
+	for tag := range f.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		rx, err := regexp.Compile(f.Tags[tag])
+		if err != nil {
+			v.errorf(p.Key("tags").Key(tag), "error in regexp %q: %s", f.Tags[tag], err)
+			continue
 		}
+		f.tags[tag] = rx
 	}
+}
 
-	return nil
+// Compile - compiles the regexps of all resources and resource groups. Validate does this
+// for loaded configs, configs built in code need to be compiled once before use.
+func (c *Config) Compile() error {
+	v := &validator{}
+	for i := range c.Resources {
+		c.Resources[i].compileFilters(v, Path{"resources", i})
+	}
+	for i := range c.ResourceGroups {
+		c.ResourceGroups[i].compileFilters(v, Path{"resource_groups", i})
+	}
+	return v.result()
+}
+
+// Validate - checks the whole configuration and returns all problems found as ValidationErrors.
+func (c *Config) Validate() (err error) {
+	v := &validator{lines: parseYAMLLines(c.source)}
+
+	v.checkOverflow(c.XXX, nil)
+	v.validateCredentials(&c.Credentials, Path{"credentials"})
+	v.validateTagLabels(c.TagLabels, Path{"tag_labels"})
+
+	for i := range c.Resources {
+		v.validateResource(&c.Resources[i], Path{"resources", i})
+	}
+
+	for i := range c.ResourceGroups {
+		v.validateResourceGroup(&c.ResourceGroups[i], Path{"resource_groups", i})
+	}
+
+	appInsightsSegments := make(map[string][]string)
+	for i := range c.AppInsights {
+		v.validateAppInsights(&c.AppInsights[i], appInsightsSegments, Path{"app_insights", i})
+	}
+
+	for i := range c.Costs {
+		v.validateCost(&c.Costs[i], Path{"costs", i})
+	}
+
+	logQueryNames := make(map[string]bool)
+	for i := range c.LogQueries {
+		v.validateLogQuery(&c.LogQueries[i], logQueryNames, Path{"log_queries", i})
+	}
+
+	if c.ActivityLog != nil {
+		v.validateActivityLog(c.ActivityLog, Path{"activity_log"})
+	}
+
+	if c.Advisor != nil {
+		v.checkOverflow(c.Advisor.XXX, Path{"advisor"})
+		v.validateSlowInterval(&c.Advisor.Interval, Path{"advisor"})
+	}
+
+	if c.SecureScore != nil {
+		v.checkOverflow(c.SecureScore.XXX, Path{"secure_score"})
+		v.validateSlowInterval(&c.SecureScore.Interval, Path{"secure_score"})
+	}
+
+	if c.Quotas != nil {
+		v.validateQuotas(c.Quotas, Path{"quotas"})
+	}
+
+	var modules []string
+	for name := range c.Modules {
+		modules = append(modules, name)
+	}
+	sort.Strings(modules)
+	for _, name := range modules {
+		m := c.Modules[name]
+		p := Path{"modules", name}
+		v.checkOverflow(m.XXX, p)
+		v.validateMetrics(m.Metrics, m.Aggregations, p)
+		v.validateNullPolicies(m.NullPolicy, m.MetricNullPolicies, p)
+	}
+
+	return v.result()
+}
+
+// Validate checks a module, or an ad-hoc selection of metrics passed to /probe.
+func (m *Module) Validate() error {
+	if len(m.Metrics) == 0 {
+		return fmt.Errorf("At least one metric needs to be specified")
+	}
+
+	return validateAggregations(m.Aggregations)
 }
 
 // Credentials - Azure credentials
@@ -120,87 +464,223 @@ type Credentials struct {
 	SubscriptionID string `yaml:"subscription_id"`
 	ClientID       string `yaml:"client_id"`
 	ClientSecret   string `yaml:"client_secret"`
-	TenantID       string `yaml:"tenant_id"`
+	// ClientSecretFile is read into ClientSecret. Relative paths are resolved against the config file's directory.
+	ClientSecretFile string `yaml:"client_secret_file"`
+	TenantID         string `yaml:"tenant_id"`
 
 	XXX map[string]interface{} `yaml:",inline"`
 }
 
+func (c *Credentials) loadSecretFile(dir string) error {
+	if c.ClientSecretFile == "" {
+		return nil
+	}
+	if c.ClientSecret != "" {
+		return fmt.Errorf("at most one of client_secret and client_secret_file must be configured")
+	}
+
+	if !filepath.IsAbs(c.ClientSecretFile) {
+		c.ClientSecretFile = filepath.Join(dir, c.ClientSecretFile)
+	}
+	secret, err := ioutil.ReadFile(c.ClientSecretFile)
+	if err != nil {
+		return err
+	}
+	c.ClientSecret = strings.TrimSpace(string(secret))
+
+	return nil
+}
+
 // Target represents Azure target resource and its associated metric definitions
 type Resource struct {
-	Name         string   `yaml:"name"`
-	Metrics      []string `yaml:"metrics"`
-	Aggregations []string `yaml:"aggregations"`
+	Name string `yaml:"name"`
+	// Namespace is the metric namespace of the metrics, e.g. azure.vm.linux.guestmetrics
+	// for guest metrics. By default, the platform metrics of the resource type are used.
+	Namespace     string     `yaml:"namespace"`
+	Metrics       MetricList `yaml:"metrics"`
+	MetricInclude []string   `yaml:"metric_include"`
+	MetricExclude []string   `yaml:"metric_exclude"`
+	Aggregations  []string   `yaml:"aggregations"`
+	// NullPolicy applies to metrics not listed in MetricNullPolicies, see NullPolicyLast, NullPolicySkip and NullPolicyNaN.
+	NullPolicy         string            `yaml:"null_policy"`
+	MetricNullPolicies map[string]string `yaml:"metric_null_policies"`
+	// ResourceHealth enables the export of the Resource Health availability status.
+	ResourceHealth bool `yaml:"resource_health"`
 
 	XXX map[string]interface{} `yaml:",inline"`
+
+	// Compiled by Validate or Compile.
+	filtersValid bool
+	metricFilter metricFilter
 }
 
 // Target represents Azure target resource and its associated metric definitions
 type ResourceGroup struct {
-	Name            string   `yaml:"name"`
-	ResourceTypes   []string `yaml:"resource_types"`
-	ResourceInclude []string `yaml:"resource_include"`
-	ResourceExclude []string `yaml:"resource_exclude"`
-	Metrics         []string `yaml:"metrics"`
-	Aggregations    []string `yaml:"aggregations"`
+	// Name is the name of the resource group, or a glob pattern matching the names of
+	// multiple groups. "*" selects all resources of the subscription.
+	Name               string            `yaml:"name"`
+	NameRegexp         string            `yaml:"name_regexp"`
+	ResourceTypes      []string          `yaml:"resource_types"`
+	ResourceInclude    []string          `yaml:"resource_include"`
+	ResourceExclude    []string          `yaml:"resource_exclude"`
+	IncludeFilters     []ResourceFilter  `yaml:"include_filters"`
+	ExcludeFilters     []ResourceFilter  `yaml:"exclude_filters"`
+	Namespace          string            `yaml:"namespace"`
+	Metrics            MetricList        `yaml:"metrics"`
+	MetricInclude      []string          `yaml:"metric_include"`
+	MetricExclude      []string          `yaml:"metric_exclude"`
+	Aggregations       []string          `yaml:"aggregations"`
+	NullPolicy         string            `yaml:"null_policy"`
+	MetricNullPolicies map[string]string `yaml:"metric_null_policies"`
+	ResourceHealth     bool              `yaml:"resource_health"`
 
 	XXX map[string]interface{} `yaml:",inline"`
+
+	// Compiled by Validate or Compile.
+	filtersValid    bool
+	nameRegexp      *regexp.Regexp
+	resourceInclude []*regexp.Regexp
+	resourceExclude []*regexp.Regexp
+	metricFilter    metricFilter
 }
 
-func checkOverflow(m map[string]interface{}, ctx string) error {
-	if len(m) > 0 {
-		var keys []string
-		for k := range m {
-			keys = append(keys, k)
-		}
-		return fmt.Errorf("unknown fields in %s: %s", ctx, strings.Join(keys, ", "))
-	}
-	return nil
+// AllResourceGroups - reports whether the entry applies to all resource groups in the subscription.
+func (t *ResourceGroup) AllResourceGroups() bool {
+	return t.Name == "*"
 }
 
-// UnmarshalYAML implements the yaml.Unmarshaler interface.
-func (s *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	type plain Config
-	if err := unmarshal((*plain)(s)); err != nil {
-		return err
+// IsPattern - reports whether the entry applies to resource groups matched by a pattern
+// rather than to a single resource group of the given name.
+func (t *ResourceGroup) IsPattern() bool {
+	return t.NameRegexp != "" || strings.ContainsAny(t.Name, "*?[\\")
+}
+
+// MatchesGroup - reports whether the entry applies to the named resource group.
+// Like in Azure, resource group names are compared case-insensitively. If the entry
+// was not compiled or any of its regexps is invalid, no group is matched.
+func (t *ResourceGroup) MatchesGroup(name string) bool {
+	if !t.filtersValid {
+		return false
 	}
-	if err := checkOverflow(s.XXX, "config"); err != nil {
-		return err
+	if t.nameRegexp != nil {
+		return t.nameRegexp.MatchString(name)
 	}
-	return nil
+	matched, err := path.Match(strings.ToLower(t.Name), strings.ToLower(name))
+	return err == nil && matched
 }
 
-// UnmarshalYAML implements the yaml.Unmarshaler interface.
-func (s *Credentials) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	type plain Credentials
-	if err := unmarshal((*plain)(s)); err != nil {
-		return err
+// Selector - describes which resource groups the entry applies to, for use in messages.
+func (t *ResourceGroup) Selector() string {
+	if t.NameRegexp != "" {
+		return fmt.Sprintf("~%q", t.NameRegexp)
 	}
-	if err := checkOverflow(s.XXX, "config"); err != nil {
-		return err
+	return t.Name
+}
+
+// ResourceFilter selects resources by their attributes. Each attribute is a regexp
+// and all given attributes must match for the filter to match.
+type ResourceFilter struct {
+	ID       string            `yaml:"id"`
+	Name     string            `yaml:"name"`
+	Type     string            `yaml:"type"`
+	Location string            `yaml:"location"`
+	Tags     map[string]string `yaml:"tags"`
+
+	XXX map[string]interface{} `yaml:",inline"`
+
+	// Compiled by Validate.
+	id, name, resourceType, location *regexp.Regexp
+	tags                             map[string]*regexp.Regexp
+}
+
+// ResourceAttributes - the attributes of a resource that filters match on.
+type ResourceAttributes struct {
+	ID       string
+	Name     string
+	Type     string
+	Location string
+	Tags     map[string]string
+}
+
+func matchesAny(regexps []*regexp.Regexp, s string) bool {
+	for _, rx := range regexps {
+		if rx.MatchString(s) {
+			return true
+		}
 	}
-	return nil
+	return false
 }
 
-// UnmarshalYAML implements the yaml.Unmarshaler interface.
-func (s *Resource) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	type plain Resource
-	if err := unmarshal((*plain)(s)); err != nil {
-		return err
+// Matches - reports whether all attributes given in the filter match the resource.
+// Tag names are compared case-insensitively, a missing tag has an empty value.
+func (f *ResourceFilter) Matches(r ResourceAttributes) bool {
+	for _, attr := range []struct {
+		rx    *regexp.Regexp
+		value string
+	}{
+		{f.id, r.ID},
+		{f.name, r.Name},
+		{f.resourceType, r.Type},
+		{f.location, r.Location},
+	} {
+		if attr.rx != nil && !attr.rx.MatchString(attr.value) {
+			return false
+		}
 	}
-	if err := checkOverflow(s.XXX, "config"); err != nil {
-		return err
+
+	for tag, rx := range f.tags {
+		value := ""
+		for k, v := range r.Tags {
+			if strings.EqualFold(k, tag) {
+				value = v
+				break
+			}
+		}
+		if !rx.MatchString(value) {
+			return false
+		}
 	}
-	return nil
+
+	return true
 }
 
-// UnmarshalYAML implements the yaml.Unmarshaler interface.
-func (s *ResourceGroup) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	type plain ResourceGroup
-	if err := unmarshal((*plain)(s)); err != nil {
-		return err
+// Selects - reports whether a resource of the group passes its include and exclude
+// filters. Without any include filter all resources are included, excludes take
+// precedence over includes. If the entry was not compiled or any of its regexps is
+// invalid, no resource is selected.
+func (t *ResourceGroup) Selects(r ResourceAttributes) bool {
+	if !t.filtersValid {
+		return false
 	}
-	if err := checkOverflow(s.XXX, "config"); err != nil {
-		return err
+	if len(t.resourceInclude) > 0 || len(t.IncludeFilters) > 0 {
+		include := matchesAny(t.resourceInclude, r.Name)
+		for i := 0; !include && i < len(t.IncludeFilters); i++ {
+			include = t.IncludeFilters[i].Matches(r)
+		}
+		if !include {
+			return false
+		}
 	}
-	return nil
+
+	if matchesAny(t.resourceExclude, r.Name) {
+		return false
+	}
+	for i := range t.ExcludeFilters {
+		if t.ExcludeFilters[i].Matches(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Module represents a named selection of metrics that can be probed for any resource
+type Module struct {
+	Namespace          string            `yaml:"namespace"`
+	Metrics            []string          `yaml:"metrics"`
+	Aggregations       []string          `yaml:"aggregations"`
+	NullPolicy         string            `yaml:"null_policy"`
+	MetricNullPolicies map[string]string `yaml:"metric_null_policies"`
+
+	XXX map[string]interface{} `yaml:",inline"`
 }
@@ -0,0 +1,315 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func loadTestConfig(t *testing.T, content string) (*Config, error) {
+	file := filepath.Join(t.TempDir(), "azure.yml")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadConfig(file)
+}
+
+const credentials = `credentials:
+  subscription_id: sub
+  tenant_id: tenant
+  client_id: client
+  client_secret: secret
+`
+
+func TestLoadConfig(t *testing.T) {
+	c, err := loadTestConfig(t, credentials+`
+resources:
+  - name: /resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm
+    metrics: all
+    metric_exclude:
+      - ^Disk
+resource_groups:
+  - name: prod-*
+    resource_types:
+      - Microsoft.Sql/servers/databases
+    metrics:
+      - dtu_consumption_percent
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !c.Resources[0].Metrics.All() {
+		t.Errorf("Expected metrics: all to select all metrics")
+	}
+	if c.Resources[0].SelectsMetric("Disk Read Bytes") || !c.Resources[0].SelectsMetric("Percentage CPU") {
+		t.Errorf("Unexpected metric selection of %v", c.Resources[0])
+	}
+
+	group := c.ResourceGroups[0]
+	if !group.IsPattern() || !group.MatchesGroup("PROD-west") || group.MatchesGroup("dev-west") {
+		t.Errorf("Unexpected resource group matching of %q", group.Name)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	group := ResourceGroup{
+		NameRegexp:      "^prod-",
+		ResourceExclude: []string{"-test$"},
+		IncludeFilters:  []ResourceFilter{{Location: "westeurope"}},
+		MetricExclude:   []string{"^Disk"},
+	}
+	if group.MatchesGroup("prod-west") || group.Selects(ResourceAttributes{Name: "db", Location: "westeurope"}) {
+		t.Errorf("Expected an entry that was not compiled to select nothing")
+	}
+
+	c := &Config{ResourceGroups: []ResourceGroup{group}}
+	if err := c.Compile(); err != nil {
+		t.Fatalf("Error compiling config: %v", err)
+	}
+	group = c.ResourceGroups[0]
+	if !group.MatchesGroup("PROD-west") || group.MatchesGroup("dev-west") {
+		t.Errorf("Unexpected resource group matching of %q", group.NameRegexp)
+	}
+	if group.Selects(ResourceAttributes{Name: "db-test", Location: "westeurope"}) ||
+		group.Selects(ResourceAttributes{Name: "db", Location: "northeurope"}) ||
+		!group.Selects(ResourceAttributes{Name: "db", Location: "WestEurope"}) {
+		t.Errorf("Unexpected resource selection of %+v", group)
+	}
+	if group.SelectsMetric("Disk Read Bytes") || !group.SelectsMetric("Percentage CPU") {
+		t.Errorf("Unexpected metric selection of %+v", group)
+	}
+
+	c = &Config{
+		Resources:      []Resource{{MetricInclude: []string{"("}}},
+		ResourceGroups: []ResourceGroup{{Name: "prod", ResourceInclude: []string{"("}}},
+	}
+	err := c.Compile()
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 2 || errs[0].Path.String() != "resources[0].metric_include[0]" || errs[1].Path.String() != "resource_groups[0].resource_include[0]" {
+		t.Fatalf("Expected errors for the invalid regexps, got %v", err)
+	}
+	if invalid := c.ResourceGroups[0]; invalid.MatchesGroup("prod") || invalid.Selects(ResourceAttributes{Name: "db"}) || invalid.SelectsMetric("cpu") {
+		t.Errorf("Expected an invalid regexp to select nothing")
+	}
+	if c.Resources[0].SelectsMetric("cpu") {
+		t.Errorf("Expected an invalid metric_include to select nothing")
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	_, err := loadTestConfig(t, credentials+`
+resources:
+  - name: resourceGroups/rg
+    metrics:
+      - Percentage CPU
+    aggregations:
+      - Median
+resource_groups:
+  - name: rg
+    metrics:
+      - Requests
+    unknown: 1
+    null_policy: zero
+`)
+
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+
+	want := []struct {
+		line int
+		path string
+	}{
+		{8, "resources[0].name"},
+		{12, "resources[0].aggregations[0]"},
+		{14, "resource_groups[0].resource_types"},
+		{17, "resource_groups[0].unknown"},
+		{18, "resource_groups[0].null_policy"},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, w := range want {
+		if errs[i].Line != w.line || errs[i].Path.String() != w.path {
+			t.Errorf("Expected error %d at line %d, %s; got %v", i, w.line, w.path, errs[i])
+		}
+	}
+}
+
+func TestCostValidation(t *testing.T) {
+	c, err := loadTestConfig(t, credentials+`
+costs:
+  - group_by:
+      - dimension: ServiceName
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	cost := c.Costs[0]
+	if len(cost.Types) != 2 || cost.Timeframe != "MonthToDate" || cost.Interval != time.Hour {
+		t.Errorf("Expected defaults to be filled in, got %+v", cost)
+	}
+	if name := cost.GroupBy[0].LabelName(); name != "service_name" {
+		t.Errorf("Expected label service_name, got %s", name)
+	}
+
+	_, err = loadTestConfig(t, credentials+`
+costs:
+  - types:
+      - Forecast
+    timeframe: Tomorrow
+    group_by:
+      - tag: team
+      - tag: env
+        dimension: ResourceGroup
+      - dimension: Currency
+`)
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+
+	want := []string{
+		"costs[0].types[0]",
+		"costs[0].timeframe",
+		"costs[0].group_by",
+		"costs[0].group_by",
+		"costs[0].group_by[1]",
+		"costs[0].group_by[2]",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, w := range want {
+		if errs[i].Path.String() != w {
+			t.Errorf("Expected error %d at %s, got %v", i, w, errs[i])
+		}
+	}
+}
+
+func TestLogQueryValidation(t *testing.T) {
+	c, err := loadTestConfig(t, credentials+`
+log_queries:
+  - name: heartbeats
+    workspace_id: 33333333-3333-3333-3333-333333333333
+    query: Heartbeat | summarize count() by Computer
+    value_column: count_
+    label_columns:
+      - Computer
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	q := c.LogQueries[0]
+	if q.Interval != 5*time.Minute || q.ISO8601Timespan() != "PT3600S" || q.MetricName() != "azure_log_heartbeats" {
+		t.Errorf("Expected defaults to be filled in, got %+v", q)
+	}
+
+	_, err = loadTestConfig(t, credentials+`
+log_queries:
+  - name: heartbeats
+    query: Heartbeat | count
+    value_column: Count
+  - name: heartbeats
+    workspace_id: 33333333-3333-3333-3333-333333333333
+    query: Heartbeat | summarize count() by Computer
+    value_column: count_
+    label_columns:
+      - computer.name
+`)
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+
+	want := []string{
+		"log_queries[0].workspace_id",
+		"log_queries[1].name",
+		"log_queries[1].label_columns[0]",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, w := range want {
+		if errs[i].Path.String() != w {
+			t.Errorf("Expected error %d at %s, got %v", i, w, errs[i])
+		}
+	}
+}
+
+func TestAppInsightsValidation(t *testing.T) {
+	_, err := loadTestConfig(t, credentials+`
+app_insights:
+  - name: /resourceGroups/web/providers/Microsoft.Insights/components/shop
+    app_id: 5a6b7c8d-9e0f-4a1b-8c2d-3e4f5a6b7c8d
+    metrics:
+      - requests/count
+    segments:
+      - cloud/roleName
+      - request/resultCode
+  - name: /resourceGroups/web/providers/Microsoft.Insights/components/blog
+    app_id: 6b7c8d9e-0f1a-4b2c-9d3e-4f5a6b7c8d9e
+    metrics:
+      - exceptions/count
+      - Requests/Count
+    segments:
+      - request/resultCode
+  - name: /resourceGroups/web/providers/Microsoft.Insights/components/wiki
+    app_id: 7c8d9e0f-1a2b-4c3d-8e4f-5a6b7c8d9e0f
+    metrics:
+      - requests/count
+    segments:
+      - Request/ResultCode
+      - Cloud/RoleName
+`)
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+	if len(errs) != 1 || errs[0].Path.String() != "app_insights[1].metrics[1]" {
+		t.Errorf("Expected an error for the segments of app_insights[1].metrics[1], got %v", errs)
+	}
+}
+
+func TestQuotaValidation(t *testing.T) {
+	c, err := loadTestConfig(t, credentials+`
+quotas:
+  locations:
+    - West Europe
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if q := c.Quotas; len(q.Providers) != 3 || q.Locations[0] != "westeurope" {
+		t.Errorf("Expected defaults and normalized locations, got %+v", q)
+	}
+
+	_, err = loadTestConfig(t, credentials+`
+quotas:
+  providers:
+    - Microsoft.Compute
+    - microsoft.compute
+  locations:
+    - westeurope
+    - West Europe
+`)
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+	want := []string{
+		"quotas.providers[1]",
+		"quotas.locations[1]",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, w := range want {
+		if errs[i].Path.String() != w {
+			t.Errorf("Expected error %d at %s, got %v", i, w, errs[i])
+		}
+	}
+}
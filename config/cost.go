@@ -0,0 +1,112 @@
+package config
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Cost - a Cost Management query for the subscription or a resource group, whose
+// results are exported as azure_cost.
+type Cost struct {
+	// ResourceGroup limits the query to a resource group instead of the subscription.
+	ResourceGroup string `yaml:"resource_group"`
+	// Types are the cost types to query, ActualCost and AmortizedCost by default.
+	Types []string `yaml:"types"`
+	// Timeframe is the period the costs are summed up for, MonthToDate by default.
+	Timeframe string         `yaml:"timeframe"`
+	GroupBy   []CostGrouping `yaml:"group_by"`
+	// Interval is how long results are cached, as the Cost Management API is heavily throttled.
+	Interval time.Duration `yaml:"interval"`
+
+	XXX map[string]interface{} `yaml:",inline"`
+}
+
+// CostGrouping - a dimension or tag to group costs by.
+type CostGrouping struct {
+	Dimension string `yaml:"dimension"`
+	Tag       string `yaml:"tag"`
+
+	XXX map[string]interface{} `yaml:",inline"`
+}
+
+const defaultCostInterval = time.Hour
+
+var (
+	costTypes      = []string{"ActualCost", "AmortizedCost"}
+	costTimeframes = []string{"MonthToDate", "BillingMonthToDate", "TheLastMonth", "TheLastBillingMonth", "WeekToDate", "Today", "Yesterday"}
+
+	// Labels every cost metric carries besides those of the groupings.
+	costLabels = []string{"subscription_id", "scope", "type", "timeframe", "currency"}
+
+	lowerUpper        = regexp.MustCompile("([a-z0-9])([A-Z])")
+	invalidLabelChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+)
+
+// LabelName - returns the label the grouping is exported as, e.g. service_name for the
+// ServiceName dimension and tag_env for the env tag.
+func (g CostGrouping) LabelName() string {
+	if g.Tag != "" {
+		return "tag_" + strings.ToLower(invalidLabelChars.ReplaceAllString(g.Tag, "_"))
+	}
+	name := lowerUpper.ReplaceAllString(g.Dimension, "${1}_${2}")
+	return strings.ToLower(invalidLabelChars.ReplaceAllString(name, "_"))
+}
+
+func oneOf(valid []string, s string) bool {
+	for _, v := range valid {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCost checks a cost query and fills in its defaults.
+func (v *validator) validateCost(c *Cost, p Path) {
+	v.checkOverflow(c.XXX, p)
+
+	if len(c.Types) == 0 {
+		c.Types = costTypes
+	}
+	for i, t := range c.Types {
+		if !oneOf(costTypes, t) {
+			v.errorf(p.Key("types").Index(i), "%s is not one of the valid cost types (%v)", t, costTypes)
+		}
+	}
+
+	if c.Timeframe == "" {
+		c.Timeframe = "MonthToDate"
+	}
+	if !oneOf(costTimeframes, c.Timeframe) {
+		v.errorf(p.Key("timeframe"), "%s is not one of the valid timeframes (%v)", c.Timeframe, costTimeframes)
+	}
+
+	if c.Interval == 0 {
+		c.Interval = defaultCostInterval
+	} else if c.Interval < 0 {
+		v.errorf(p.Key("interval"), "interval must not be negative")
+	}
+
+	// The Cost Management API accepts at most two groupings, one of them by tag.
+	if len(c.GroupBy) > 2 {
+		v.errorf(p.Key("group_by"), "at most two groupings may be specified")
+	}
+	tags := 0
+	for i, g := range c.GroupBy {
+		gp := p.Key("group_by").Index(i)
+		v.checkOverflow(g.XXX, gp)
+		if (g.Dimension == "") == (g.Tag == "") {
+			v.errorf(gp, "exactly one of dimension and tag needs to be specified")
+		}
+		if g.Tag != "" {
+			tags++
+		}
+		if oneOf(costLabels, g.LabelName()) {
+			v.errorf(gp, "grouping is exported as label %q, which is reserved", g.LabelName())
+		}
+	}
+	if tags > 1 {
+		v.errorf(p.Key("group_by"), "costs can only be grouped by one tag")
+	}
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LogQuery - a KQL query against a Log Analytics workspace, whose result rows are
+// exported as samples of the gauge azure_log_<name>.
+type LogQuery struct {
+	Name        string `yaml:"name"`
+	WorkspaceID string `yaml:"workspace_id"`
+	Query       string `yaml:"query"`
+	// Timespan is how far back the query looks, 1h by default.
+	Timespan time.Duration `yaml:"timespan"`
+	// ValueColumn is the column holding the sample values.
+	ValueColumn string `yaml:"value_column"`
+	// LabelColumns are columns exported as labels of the same name.
+	LabelColumns []string `yaml:"label_columns"`
+	// Interval is how long results are reused before the query is run again, 5m by default.
+	Interval time.Duration `yaml:"interval"`
+
+	XXX map[string]interface{} `yaml:",inline"`
+}
+
+const (
+	defaultLogQueryTimespan = time.Hour
+	defaultLogQueryInterval = 5 * time.Minute
+)
+
+var validMetricName = regexp.MustCompile("^[a-zA-Z_:][a-zA-Z0-9_:]*$")
+
+// MetricName - returns the name the results of the query are exported as.
+func (q LogQuery) MetricName() string {
+	return "azure_log_" + q.Name
+}
+
+// ISO8601Timespan - returns the timespan in the ISO 8601 format used by the query API.
+func (q LogQuery) ISO8601Timespan() string {
+	return fmt.Sprintf("PT%dS", int64(q.Timespan/time.Second))
+}
+
+// validateLogQuery checks a log query and fills in its defaults. names are the names of
+// the queries validated before.
+func (v *validator) validateLogQuery(q *LogQuery, names map[string]bool, p Path) {
+	v.checkOverflow(q.XXX, p)
+
+	if !validMetricName.MatchString(q.Name) {
+		v.errorf(p.Key("name"), "name %q is not valid in a Prometheus metric name", q.Name)
+	} else if names[q.Name] {
+		v.errorf(p.Key("name"), "there is already a query named %s", q.Name)
+	}
+	names[q.Name] = true
+
+	required := []struct {
+		key, value string
+	}{
+		{"workspace_id", q.WorkspaceID},
+		{"query", q.Query},
+		{"value_column", q.ValueColumn},
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.value) == "" {
+			v.errorf(p.Key(r.key), "%s needs to be specified", r.key)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, column := range q.LabelColumns {
+		if !validLabelName.MatchString(column) {
+			v.errorf(p.Key("label_columns").Index(i), "column %q is not a valid Prometheus label name", column)
+		}
+		if seen[column] {
+			v.errorf(p.Key("label_columns").Index(i), "column %q is listed more than once", column)
+		}
+		if column == q.ValueColumn {
+			v.errorf(p.Key("label_columns").Index(i), "column %q is the value column", column)
+		}
+		seen[column] = true
+	}
+
+	if q.Timespan == 0 {
+		q.Timespan = defaultLogQueryTimespan
+	} else if q.Timespan < time.Second {
+		v.errorf(p.Key("timespan"), "timespan must be at least 1s")
+	}
+	if q.Interval == 0 {
+		q.Interval = defaultLogQueryInterval
+	} else if q.Interval < 0 {
+		v.errorf(p.Key("interval"), "interval must not be negative")
+	}
+}
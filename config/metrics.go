@@ -0,0 +1,139 @@
+package config
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MetricList - names of the metrics to query. The single name "all" selects all
+// metrics defined for a resource, which may be narrowed with metric_include and
+// metric_exclude. A scalar value is read as a list with a single name.
+type MetricList []string
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (m *MetricList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*m = MetricList{name}
+		return nil
+	}
+
+	var names []string
+	if err := unmarshal(&names); err != nil {
+		return err
+	}
+	*m = names
+	return nil
+}
+
+// All - reports whether all metrics defined for a resource are selected.
+func (m MetricList) All() bool {
+	return len(m) == 1 && m[0] == "all"
+}
+
+// metricFilter holds the compiled metric_include and metric_exclude regexps of a target.
+type metricFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func (f metricFilter) selects(name string) bool {
+	if len(f.include) > 0 && !matchesAny(f.include, name) {
+		return false
+	}
+	return !matchesAny(f.exclude, name)
+}
+
+// SelectsMetric - reports whether a metric defined for the resource is selected by metrics: all.
+// If the entry was not compiled or metric_include or metric_exclude are invalid, no
+// metric is selected.
+func (t *Resource) SelectsMetric(name string) bool {
+	return t.filtersValid && t.metricFilter.selects(name)
+}
+
+// SelectsMetric - reports whether a metric defined for the resources is selected by metrics: all.
+// If the entry was not compiled or any of its regexps is invalid, no metric is selected.
+func (t *ResourceGroup) SelectsMetric(name string) bool {
+	return t.filtersValid && t.metricFilter.selects(name)
+}
+
+func (v *validator) validateMetricFilter(metrics MetricList, include []string, exclude []string, p Path) {
+	if !metrics.All() && len(include)+len(exclude) > 0 {
+		v.errorf(p.Key("metrics"), "metric_include and metric_exclude can only be used with metrics: all")
+	}
+}
+
+func (v *validator) compileMetricFilter(include []string, exclude []string, p Path) metricFilter {
+	return metricFilter{
+		include: v.compileAll(include, p.Key("metric_include")),
+		exclude: v.compileAll(exclude, p.Key("metric_exclude")),
+	}
+}
+
+// Policies for aggregation values without data, which Azure omits from responses.
+const (
+	// NullPolicyLast - use the last value in the queried time window that is not null.
+	NullPolicyLast = "last"
+	// NullPolicySkip - don't export a value if the last time grain has none.
+	NullPolicySkip = "skip"
+	// NullPolicyNaN - export NaN if the last time grain has no value.
+	NullPolicyNaN = "nan"
+)
+
+var nullPolicies = []string{NullPolicyLast, NullPolicySkip, NullPolicyNaN}
+
+// nullPolicy returns the policy configured for a metric in metricPolicies, falling
+// back to defaultPolicy and NullPolicyLast.
+func nullPolicy(metric string, defaultPolicy string, metricPolicies map[string]string) string {
+	for name, policy := range metricPolicies {
+		if strings.EqualFold(name, metric) {
+			return policy
+		}
+	}
+	if defaultPolicy != "" {
+		return defaultPolicy
+	}
+	return NullPolicyLast
+}
+
+// MetricNullPolicy - returns the policy for values of the metric without data.
+func (t *Resource) MetricNullPolicy(metric string) string {
+	return nullPolicy(metric, t.NullPolicy, t.MetricNullPolicies)
+}
+
+// MetricNullPolicy - returns the policy for values of the metric without data.
+func (t *ResourceGroup) MetricNullPolicy(metric string) string {
+	return nullPolicy(metric, t.NullPolicy, t.MetricNullPolicies)
+}
+
+// MetricNullPolicy - returns the policy for values of the metric without data.
+func (m *Module) MetricNullPolicy(metric string) string {
+	return nullPolicy(metric, m.NullPolicy, m.MetricNullPolicies)
+}
+
+func validNullPolicy(policy string) bool {
+	for _, p := range nullPolicies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *validator) validateNullPolicies(policy string, metricPolicies map[string]string, p Path) {
+	if policy != "" && !validNullPolicy(policy) {
+		v.errorf(p.Key("null_policy"), "%s is not one of the valid null policies (%v)", policy, nullPolicies)
+	}
+
+	var metrics []string
+	for metric := range metricPolicies {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+	for _, metric := range metrics {
+		if policy := metricPolicies[metric]; !validNullPolicy(policy) {
+			v.errorf(p.Key("metric_null_policies").Key(metric), "%s is not one of the valid null policies (%v)", policy, nullPolicies)
+		}
+	}
+}
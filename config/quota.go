@@ -0,0 +1,63 @@
+package config
+
+import (
+	"strings"
+)
+
+// Quotas - the subscription quotas whose usage and limits are exported.
+type Quotas struct {
+	// Providers are the resource providers whose quotas are exported, by default
+	// Microsoft.Compute, Microsoft.Network and Microsoft.Storage.
+	Providers []string `yaml:"providers"`
+	// Locations are the regions quotas are exported for. By default, these are the
+	// locations of the resources selected by resources and resource_groups.
+	Locations []string `yaml:"locations"`
+
+	XXX map[string]interface{} `yaml:",inline"`
+}
+
+// QuotaProviders are the resource providers with a usages API.
+var QuotaProviders = []string{"Microsoft.Compute", "Microsoft.Network", "Microsoft.Storage"}
+
+// validateQuotas checks the quota settings and fills in their defaults.
+func (v *validator) validateQuotas(q *Quotas, p Path) {
+	v.checkOverflow(q.XXX, p)
+
+	if len(q.Providers) == 0 {
+		q.Providers = append([]string(nil), QuotaProviders...)
+	}
+	// Quotas listed twice would be exported twice, which Prometheus rejects.
+	seen := make(map[string]bool)
+	for i, provider := range q.Providers {
+		valid := false
+		for _, qp := range QuotaProviders {
+			if strings.EqualFold(provider, qp) {
+				q.Providers[i] = qp
+				valid = true
+			}
+		}
+		if !valid {
+			v.errorf(p.Key("providers").Index(i), "%s is not one of the supported providers (%v)", provider, QuotaProviders)
+		} else if seen[q.Providers[i]] {
+			v.errorf(p.Key("providers").Index(i), "provider %s is listed more than once", provider)
+		}
+		seen[q.Providers[i]] = true
+	}
+
+	seen = make(map[string]bool)
+	for i, location := range q.Locations {
+		q.Locations[i] = NormalizeLocation(location)
+		if q.Locations[i] == "" {
+			v.errorf(p.Key("locations").Index(i), "location must not be empty")
+		} else if seen[q.Locations[i]] {
+			v.errorf(p.Key("locations").Index(i), "location %s is listed more than once", location)
+		}
+		seen[q.Locations[i]] = true
+	}
+}
+
+// NormalizeLocation - returns the name of a location as used by the Azure APIs, e.g. westeurope.
+// Azure also accepts display names like West Europe.
+func NormalizeLocation(location string) string {
+	return strings.ToLower(strings.Replace(location, " ", "", -1))
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Path - location of an element in the config file, made up of map keys (strings)
+// and sequence indices (ints).
+type Path []interface{}
+
+// Key - returns the path of the map entry k below p.
+func (p Path) Key(k string) Path {
+	return append(p[:len(p):len(p)], k)
+}
+
+// Index - returns the path of the sequence item i below p.
+func (p Path) Index(i int) Path {
+	return append(p[:len(p):len(p)], i)
+}
+
+func (p Path) String() string {
+	var b strings.Builder
+	for i, elem := range p {
+		switch e := elem.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", e)
+		default:
+			if i > 0 {
+				b.WriteByte('.')
+			}
+			fmt.Fprint(&b, e)
+		}
+	}
+	return b.String()
+}
+
+// ValidationError - a problem with the config element at Path.
+type ValidationError struct {
+	Path Path
+	// Line is the line of the element in the config file, or 0 if it is unknown.
+	Line    int
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	switch {
+	case e.Line > 0:
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Path, e.Message)
+	case len(e.Path) > 0:
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	}
+	return e.Message
+}
+
+// ValidationErrors - all problems found while validating a config, ordered by line.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	var msgs []string
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// yamlLine is a non-empty line of a YAML document, reduced to what is needed to
+// locate elements in block style documents.
+type yamlLine struct {
+	number int
+	// indent is the column of the first character, which may be a sequence dash.
+	indent int
+	dash   bool
+	// keyCol is the column of the mapping key on this line, or -1 if there is none.
+	keyCol int
+	key    string
+}
+
+var yamlKey = regexp.MustCompile(`^("([^"]*)"|'([^']*)'|[^\s"'#{\[-][^:#]*?)\s*:(\s|$)`)
+
+func parseYAMLLines(src []byte) []yamlLine {
+	var lines []yamlLine
+	for i, text := range strings.Split(string(src), "\n") {
+		text = strings.TrimRight(text, "\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+
+		l := yamlLine{number: i + 1, indent: len(text) - len(trimmed), keyCol: -1}
+		rest, col := trimmed, l.indent
+		if rest == "-" || strings.HasPrefix(rest, "- ") {
+			l.dash = true
+			after := strings.TrimLeft(rest[1:], " ")
+			col += len(rest) - len(after)
+			rest = after
+		}
+		if m := yamlKey.FindStringSubmatch(rest); m != nil {
+			l.keyCol = col
+			switch {
+			case strings.HasPrefix(m[1], `"`):
+				l.key = m[2]
+			case strings.HasPrefix(m[1], "'"):
+				l.key = m[3]
+			default:
+				l.key = m[1]
+			}
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+// lineOf returns the line of the element at path. If the element cannot be
+// found, e.g. because it is missing or written in flow style, the line of its
+// closest ancestor is returned, or 0 if none is found.
+func lineOf(lines []yamlLine, path Path) int {
+	start, end := 0, len(lines)
+	line := 0
+
+	for _, elem := range path {
+		if start >= end {
+			return line
+		}
+
+		found := -1
+		switch e := elem.(type) {
+		case string:
+			indent := lines[start].keyCol
+			for i := start; i < end; i++ {
+				if lines[i].keyCol == indent && lines[i].key == e {
+					found = i
+					break
+				}
+			}
+			if found < 0 {
+				return line
+			}
+
+			// The value spans all following lines that are indented deeper than
+			// the key, plus sequence items at the key's own column.
+			next := found + 1
+			for next < end && (lines[next].indent > indent || lines[next].dash && lines[next].indent == indent) {
+				next++
+			}
+			start, end = found+1, next
+		case int:
+			if !lines[start].dash {
+				return line
+			}
+			indent := lines[start].indent
+			n := -1
+			for i := start; i < end; i++ {
+				if lines[i].dash && lines[i].indent == indent {
+					n++
+					if n == e {
+						found = i
+						break
+					}
+				}
+			}
+			if found < 0 {
+				return line
+			}
+
+			// The item starts on its dash line, which may already hold the first key.
+			next := found + 1
+			for next < end && lines[next].indent > indent {
+				next++
+			}
+			start, end = found, next
+		}
+		line = lines[found].number
+	}
+
+	return line
+}
+
+// validator collects all problems of a config instead of stopping at the first.
+type validator struct {
+	lines []yamlLine
+	errs  ValidationErrors
+}
+
+func (v *validator) errorf(p Path, format string, args ...interface{}) {
+	v.errs = append(v.errs, &ValidationError{
+		Path:    p,
+		Line:    lineOf(v.lines, p),
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// checkOverflow reports each field caught by an inline XXX map as unknown.
+func (v *validator) checkOverflow(m map[string]interface{}, p Path) {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v.errorf(p.Key(k), "unknown field %q", k)
+	}
+}
+
+func (v *validator) result() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(v.errs, func(i, j int) bool {
+		return v.errs[i].Line < v.errs[j].Line
+	})
+	return v.errs
+}
+
+// ErrorAt - returns a validation error for the element at path p, including its
+// line in the config file. It allows callers to report problems that can only
+// be detected outside of Validate, e.g. with the help of the Azure API.
+func (c *Config) ErrorAt(p Path, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{
+		Path:    p,
+		Line:    lineOf(parseYAMLLines(c.source), p),
+		Message: fmt.Sprintf(format, args...),
+	}
+}
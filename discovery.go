@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/credativ/azure_metrics_exporter/exporter"
+)
+
+// discoveryHandler serves the discovered resources for Prometheus' http_sd_configs.
+// Discovery errors are answered with an error status, so that Prometheus keeps the
+// targets it discovered last.
+func discoveryHandler(w http.ResponseWriter, r *http.Request) {
+	groups, err := exporter.DiscoverTargets(getConfig())
+	if err != nil {
+		log.Printf("Error discovering targets: %v", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := json.Marshal(groups)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
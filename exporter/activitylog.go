@@ -0,0 +1,306 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/credativ/azure_metrics_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AzureActivityLogEvent represents an event of the Activity Log.
+type AzureActivityLogEvent struct {
+	EventDataID    string    `json:"eventDataId"`
+	EventTimestamp time.Time `json:"eventTimestamp"`
+	OperationName  struct {
+		Value string `json:"value"`
+	} `json:"operationName"`
+	Status struct {
+		Value string `json:"value"`
+	} `json:"status"`
+	ResourceType struct {
+		Value string `json:"value"`
+	} `json:"resourceType"`
+	Category struct {
+		Value string `json:"value"`
+	} `json:"category"`
+	// Caller is the UPN of users and the object ID of service principals, if there is one.
+	Caller string `json:"caller"`
+	// Claims are the claims of the token the operation was authorized with.
+	Claims map[string]string `json:"claims"`
+}
+
+// Types of callers distinguished by azure_activity_log_events_total.
+const (
+	callerTypeUser             = "User"
+	callerTypeServicePrincipal = "ServicePrincipal"
+	callerTypeUnknown          = "Unknown"
+)
+
+var objectID = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+
+// CallerType returns whether the event was caused by a user or a service principal, such as
+// an application or a managed identity, or Unknown, e.g. for events caused by Azure itself.
+func (e AzureActivityLogEvent) CallerType() string {
+	switch e.Claims["idtyp"] {
+	case "user":
+		return callerTypeUser
+	case "app":
+		return callerTypeServicePrincipal
+	}
+	// Older tokens lack idtyp, but only tokens of users carry a UPN.
+	switch {
+	case e.Claims["http://schemas.xmlsoap.org/ws/2005/05/identity/claims/upn"] != "", strings.Contains(e.Caller, "@"):
+		return callerTypeUser
+	case e.Claims["appid"] != "" && objectID.MatchString(e.Caller):
+		return callerTypeServicePrincipal
+	}
+	return callerTypeUnknown
+}
+
+// AzureActivityLogResponse represents a page of Activity Log events.
+type AzureActivityLogResponse struct {
+	Value    []AzureActivityLogEvent `json:"value"`
+	NextLink string                  `json:"nextLink"`
+}
+
+// ListActivityLogEvents returns the Activity Log events of the subscription between from
+// and to that match filter, an OData filter which may be empty.
+func (ac *AzureClient) ListActivityLogEvents(from time.Time, to time.Time, filter string) ([]AzureActivityLogEvent, error) {
+	apiVersion := "2015-04-01"
+
+	timeFilter := fmt.Sprintf("eventTimestamp ge '%s' and eventTimestamp le '%s'", from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+	if filter != "" {
+		timeFilter += " and " + filter
+	}
+	values := url.Values{}
+	values.Add("api-version", apiVersion)
+	values.Add("$filter", timeFilter)
+	values.Add("$select", "eventDataId,eventTimestamp,operationName,status,resourceType,category,caller,claims")
+	endpoint := fmt.Sprintf("https://management.azure.com/subscriptions/%s/providers/microsoft.insights/eventtypes/management/values?%s", ac.credentials.SubscriptionID, values.Encode())
+
+	var events []AzureActivityLogEvent
+	for endpoint != "" {
+		body, err := ac.getJSON(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to query activity log API: %v", err)
+		}
+
+		var page AzureActivityLogResponse
+		err = json.Unmarshal(body, &page)
+		if err != nil {
+			return nil, fmt.Errorf("Error unmarshalling response body: %v", err)
+		}
+		events = append(events, page.Value...)
+		endpoint = page.NextLink
+	}
+
+	return events, nil
+}
+
+// Events may show up in the Activity Log some minutes after they happened, so each
+// query reaches back this far before the watermark.
+const activityLogOverlap = 15 * time.Minute
+
+// After a long downtime, the events since the watermark are counted over several polls,
+// each querying at most this much time past the watermark.
+const activityLogMaxRange = time.Hour
+
+// activityLogState is the part of ActivityLog persisted across restarts.
+type activityLogState struct {
+	// Watermark is the time up to which events were counted.
+	Watermark time.Time `json:"watermark"`
+	// Seen holds the timestamps of the counted events within the overlap before the
+	// watermark by event ID, as these are returned again by the next query.
+	Seen map[string]time.Time `json:"seen"`
+}
+
+type activityLogKey struct {
+	operationName, status, resourceType, category, callerType string
+}
+
+// ActivityLog counts Activity Log events. Unlike collectors, it lives as long as the
+// exporter, so counts increase across scrapes.
+type ActivityLog struct {
+	mu        sync.Mutex
+	stateFile string
+	state     activityLogState
+	lastPoll  time.Time
+	counts    map[activityLogKey]float64
+}
+
+// NewActivityLog returns an ActivityLog that persists its watermark in stateFile, or only
+// keeps it in memory if stateFile is empty. Without a previous watermark, counting starts
+// with the events of the overlap before now.
+func NewActivityLog(stateFile string) (*ActivityLog, error) {
+	a := &ActivityLog{
+		stateFile: stateFile,
+		state:     activityLogState{Watermark: time.Now().UTC(), Seen: make(map[string]time.Time)},
+		counts:    make(map[activityLogKey]float64),
+	}
+	if stateFile == "" {
+		return a, nil
+	}
+
+	data, err := ioutil.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading activity log state: %v", err)
+	}
+	var state activityLogState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("Error parsing activity log state %s: %v", stateFile, err)
+	}
+	if state.Seen == nil {
+		state.Seen = make(map[string]time.Time)
+	}
+	a.state = state
+	return a, nil
+}
+
+// Poll counts the events since the watermark that match filter and advances the watermark to
+// now, or by activityLogMaxRange if now is further away.
+func (a *ActivityLog) Poll(client ActivityLogAPI, filter string, now time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lastPoll = now
+
+	to := now
+	if limit := a.state.Watermark.Add(activityLogMaxRange); to.After(limit) {
+		to = limit
+	}
+	events, err := client.ListActivityLogEvents(a.state.Watermark.Add(-activityLogOverlap), to, filter)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range events {
+		if _, ok := a.state.Seen[e.EventDataID]; ok {
+			continue
+		}
+		a.state.Seen[e.EventDataID] = e.EventTimestamp
+		a.counts[activityLogKey{e.OperationName.Value, e.Status.Value, e.ResourceType.Value, e.Category.Value, e.CallerType()}]++
+	}
+
+	a.state.Watermark = to.UTC()
+	for id, t := range a.state.Seen {
+		if t.Before(a.state.Watermark.Add(-activityLogOverlap)) {
+			delete(a.state.Seen, id)
+		}
+	}
+
+	return a.save()
+}
+
+// save writes the state to the state file. Callers must hold mu.
+func (a *ActivityLog) save() error {
+	if a.stateFile == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(a.state)
+	if err != nil {
+		return fmt.Errorf("Error marshalling activity log state: %v", err)
+	}
+	// Replace the file atomically, so a crash cannot leave a truncated state behind.
+	tmp, err := ioutil.TempFile(filepath.Dir(a.stateFile), filepath.Base(a.stateFile))
+	if err != nil {
+		return fmt.Errorf("Error writing activity log state: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Error writing activity log state: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Error writing activity log state: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), a.stateFile); err != nil {
+		return fmt.Errorf("Error writing activity log state: %v", err)
+	}
+	return nil
+}
+
+// StateFile returns the file the watermark is persisted in.
+func (a *ActivityLog) StateFile() string {
+	return a.stateFile
+}
+
+// ActivityLogCollector exports the event counts of an ActivityLog, polling the
+// Activity Log first if the configured interval has passed.
+type ActivityLogCollector struct {
+	config      *config.Config
+	client      ActivityLogAPI
+	activityLog *ActivityLog
+}
+
+// NewActivityLogCollector returns a collector for the events counted by activityLog.
+func NewActivityLogCollector(cfg *config.Config, client ActivityLogAPI, activityLog *ActivityLog) *ActivityLogCollector {
+	return &ActivityLogCollector{
+		config:      cfg,
+		client:      client,
+		activityLog: activityLog,
+	}
+}
+
+func (c *ActivityLogCollector) eventsDesc() *prometheus.Desc {
+	return prometheus.NewDesc(
+		"azure_activity_log_events_total",
+		"Number of Activity Log events counted since the exporter started.",
+		[]string{"operation_name", "status", "resource_type", "category", "caller_type"},
+		prometheus.Labels{"subscription_id": c.config.Credentials.SubscriptionID},
+	)
+}
+
+func (c *ActivityLogCollector) watermarkDesc() *prometheus.Desc {
+	return prometheus.NewDesc(
+		"azure_activity_log_watermark_timestamp_seconds",
+		"Time up to which Activity Log events have been counted.",
+		nil,
+		prometheus.Labels{"subscription_id": c.config.Credentials.SubscriptionID},
+	)
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *ActivityLogCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.eventsDesc()
+	ch <- c.watermarkDesc()
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *ActivityLogCollector) Collect(ch chan<- prometheus.Metric) {
+	settings := c.config.ActivityLog
+	if settings == nil {
+		return
+	}
+
+	a := c.activityLog
+	a.mu.Lock()
+	due := time.Since(a.lastPoll) >= settings.Interval
+	a.mu.Unlock()
+	if due {
+		if err := a.Poll(c.client, settings.Filter, time.Now()); err != nil {
+			log.Printf("Failed to poll activity log: %v", err)
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	desc := c.eventsDesc()
+	for key, count := range a.counts {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, count, key.operationName, key.status, key.resourceType, key.category, key.callerType)
+	}
+	ch <- prometheus.MustNewConstMetric(c.watermarkDesc(), prometheus.GaugeValue, float64(a.state.Watermark.Unix()))
+}
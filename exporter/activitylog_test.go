@@ -0,0 +1,114 @@
+package exporter
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/credativ/azure_metrics_exporter/azuretest"
+)
+
+func TestActivityLog(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+activity_log:
+  filter: resourceGroupName eq 'web'
+`)
+	stateFile := filepath.Join(t.TempDir(), "activity_log.json")
+	now := time.Now().UTC()
+	deallocate := azuretest.ActivityLogEvent{
+		Timestamp:     now.Add(-5 * time.Minute),
+		OperationName: "Microsoft.Compute/virtualMachines/deallocate/action",
+		Status:        "Succeeded",
+		ResourceType:  "Microsoft.Compute/virtualMachines",
+		Category:      "Administrative",
+		Caller:        "alice@example.com",
+	}
+
+	first := deallocate
+	first.ID = "event-1"
+	server.AddActivityLogEvents(first)
+
+	activityLog, err := NewActivityLog(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := gather(t, NewActivityLogCollector(cfg, client, activityLog))
+	events := metrics["azure_activity_log_events_total"]
+	if len(events) != 1 || events[0].GetCounter().GetValue() != 1 {
+		t.Fatalf("Expected one event, got %v", events)
+	}
+	labels := labelMap(events[0])
+	if labels["operation_name"] != deallocate.OperationName || labels["status"] != "Succeeded" || labels["resource_type"] != deallocate.ResourceType || labels["category"] != "Administrative" || labels["caller_type"] != "User" || labels["subscription_id"] != testSubscription {
+		t.Errorf("Unexpected labels: %v", labels)
+	}
+
+	requests := server.Requests()
+	if query := requests[len(requests)-1]; !strings.Contains(query, url.QueryEscape("and resourceGroupName eq 'web'")) {
+		t.Errorf("Expected the configured filter to be applied, got %s", query)
+	}
+
+	// Events showing up late are counted, those counted before are not.
+	late := deallocate
+	late.ID = "event-2"
+	late.Timestamp = now.Add(-3 * time.Minute)
+	server.AddActivityLogEvents(late)
+	if err := activityLog.Poll(client, cfg.ActivityLog.Filter, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	metrics = gather(t, NewActivityLogCollector(cfg, client, activityLog))
+	if events := metrics["azure_activity_log_events_total"]; len(events) != 1 || events[0].GetCounter().GetValue() != 2 {
+		t.Errorf("Expected two events, got %v", events)
+	}
+
+	// After a restart, only new events are counted.
+	restarted, err := NewActivityLog(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := deallocate
+	next.ID = "event-3"
+	next.Timestamp = now.Add(90 * time.Second)
+	server.AddActivityLogEvents(next)
+	if err := restarted.Poll(client, cfg.ActivityLog.Filter, now.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if count := restarted.counts[activityLogKey{deallocate.OperationName, "Succeeded", deallocate.ResourceType, "Administrative", "User"}]; count != 1 {
+		t.Errorf("Expected one event after the restart, got %v", count)
+	}
+}
+
+func TestActivityLogCatchUp(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+activity_log: {}
+`)
+	now := time.Now().UTC()
+	server.AddActivityLogEvents(
+		azuretest.ActivityLogEvent{ID: "event-1", Timestamp: now.Add(-150 * time.Minute), OperationName: "Microsoft.Resources/deployments/write", Status: "Failed", Category: "Administrative",
+			Caller: "8d6f1c4e-2a7b-4c3d-9e8f-0a1b2c3d4e5f", Claims: map[string]string{"appid": "4b2e8c1d-7a3f-4e5d-9c6b-0a1b2c3d4e5f"}},
+		azuretest.ActivityLogEvent{ID: "event-2", Timestamp: now.Add(-30 * time.Minute), OperationName: "Microsoft.Resources/deployments/write", Status: "Failed", Category: "Administrative"},
+	)
+
+	activityLog, err := NewActivityLog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	activityLog.state.Watermark = now.Add(-3 * time.Hour)
+
+	// Each poll covers at most an hour past the watermark.
+	for i, want := range []float64{1, 1, 1} {
+		if err := activityLog.Poll(client, cfg.ActivityLog.Filter, now); err != nil {
+			t.Fatal(err)
+		}
+		if got := activityLog.state.Watermark; !got.Equal(now.Add(time.Duration(i-2) * time.Hour)) {
+			t.Errorf("Unexpected watermark after poll %d: %v", i, got)
+		}
+		if got := activityLog.counts[activityLogKey{"Microsoft.Resources/deployments/write", "Failed", "", "Administrative", "ServicePrincipal"}]; got != want {
+			t.Errorf("Expected %v events of the service principal after poll %d, got %v", want, i, got)
+		}
+	}
+	if got := activityLog.counts[activityLogKey{"Microsoft.Resources/deployments/write", "Failed", "", "Administrative", "Unknown"}]; got != 1 {
+		t.Errorf("Expected the event without caller to be counted, got %v", got)
+	}
+}
@@ -0,0 +1,114 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AzureAdvisorRecommendation represents an Azure Advisor recommendation.
+type AzureAdvisorRecommendation struct {
+	ID         string `json:"id"`
+	Properties struct {
+		Category         string `json:"category"`
+		Impact           string `json:"impact"`
+		ImpactedField    string `json:"impactedField"`
+		ImpactedValue    string `json:"impactedValue"`
+		ShortDescription struct {
+			Problem  string `json:"problem"`
+			Solution string `json:"solution"`
+		} `json:"shortDescription"`
+	} `json:"properties"`
+}
+
+// AzureAdvisorRecommendationListResponse represents a page of Advisor recommendations.
+type AzureAdvisorRecommendationListResponse struct {
+	Value    []AzureAdvisorRecommendation `json:"value"`
+	NextLink string                       `json:"nextLink"`
+}
+
+// ListAdvisorRecommendations returns the Advisor recommendations of the subscription.
+// As they change slowly, results are reused until they are maxAge old.
+func (ac *AzureClient) ListAdvisorRecommendations(maxAge time.Duration) ([]AzureAdvisorRecommendation, error) {
+	value, err := ac.cached("advisor recommendations", maxAge, func() (interface{}, error) {
+		apiVersion := "2020-01-01"
+		endpoint := fmt.Sprintf("https://management.azure.com/subscriptions/%s/providers/Microsoft.Advisor/recommendations?api-version=%s", ac.credentials.SubscriptionID, apiVersion)
+
+		var recommendations []AzureAdvisorRecommendation
+		for endpoint != "" {
+			body, err := ac.getJSON(endpoint)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to query advisor API: %v", err)
+			}
+
+			var page AzureAdvisorRecommendationListResponse
+			err = json.Unmarshal(body, &page)
+			if err != nil {
+				return nil, fmt.Errorf("Error unmarshalling response body: %v", err)
+			}
+			recommendations = append(recommendations, page.Value...)
+			endpoint = page.NextLink
+		}
+		return recommendations, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]AzureAdvisorRecommendation), nil
+}
+
+// Categories and impacts of Advisor recommendations, which are exported even without
+// recommendations so that alerts can rely on them.
+var (
+	advisorCategories = []string{"Cost", "HighAvailability", "OperationalExcellence", "Performance", "Security"}
+	advisorImpacts    = []string{"High", "Medium", "Low"}
+)
+
+// collectAdvisor exports the number of open Advisor recommendations by category and impact.
+func (c *Collector) collectAdvisor(ch chan<- prometheus.Metric) {
+	if c.config.Advisor == nil {
+		return
+	}
+
+	recommendations, err := c.client.ListAdvisorRecommendations(c.config.Advisor.Interval)
+	if err != nil {
+		log.Printf("Failed to list advisor recommendations: %v", err)
+		return
+	}
+
+	type key struct{ category, impact string }
+	counts := make(map[key]float64)
+	for _, category := range advisorCategories {
+		for _, impact := range advisorImpacts {
+			counts[key{category, impact}] = 0
+		}
+	}
+	for _, r := range recommendations {
+		counts[key{r.Properties.Category, r.Properties.Impact}]++
+	}
+
+	var keys []key
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].category != keys[j].category {
+			return keys[i].category < keys[j].category
+		}
+		return keys[i].impact < keys[j].impact
+	})
+
+	desc := prometheus.NewDesc(
+		"azure_advisor_recommendations",
+		"Number of open Azure Advisor recommendations.",
+		[]string{"category", "impact"},
+		prometheus.Labels{"subscription_id": c.config.Credentials.SubscriptionID},
+	)
+	for _, k := range keys {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, counts[k], k.category, k.impact)
+	}
+}
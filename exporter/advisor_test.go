@@ -0,0 +1,49 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/credativ/azure_metrics_exporter/azuretest"
+)
+
+func TestCollectAdvisorAndSecureScore(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+advisor:
+  interval: 6h
+secure_score: {}
+`)
+	server.SetAdvisorRecommendations(
+		azuretest.AdvisorRecommendation{Category: "Cost", Impact: "High", Problem: "Right-size underutilized virtual machines"},
+		azuretest.AdvisorRecommendation{Category: "Cost", Impact: "High", Problem: "Buy reserved instances"},
+		azuretest.AdvisorRecommendation{Category: "Security", Impact: "Medium", Problem: "Enable MFA"},
+	)
+	server.SetSecureScores(azuretest.SecureScore{Name: "ascScore", Current: 31.5, Max: 58})
+
+	for i := 0; i < 2; i++ {
+		metrics := gather(t, NewCollector(cfg, client))
+
+		recommendations := make(map[string]float64)
+		for _, m := range metrics["azure_advisor_recommendations"] {
+			labels := labelMap(m)
+			if labels["subscription_id"] != testSubscription {
+				t.Errorf("Unexpected labels: %v", labels)
+			}
+			recommendations[labels["category"]+"/"+labels["impact"]] = m.GetGauge().GetValue()
+		}
+		if len(recommendations) != 15 || recommendations["Cost/High"] != 2 || recommendations["Security/Medium"] != 1 || recommendations["Performance/Low"] != 0 {
+			t.Errorf("Unexpected recommendations: %v", recommendations)
+		}
+
+		current, max := metrics["azure_secure_score_current"], metrics["azure_secure_score_max"]
+		if len(current) != 1 || current[0].GetGauge().GetValue() != 31.5 || labelMap(current[0])["score"] != "ascScore" {
+			t.Errorf("Unexpected current secure score: %v", current)
+		}
+		if len(max) != 1 || max[0].GetGauge().GetValue() != 58 {
+			t.Errorf("Unexpected maximum secure score: %v", max)
+		}
+	}
+
+	if queries := server.CountRequests("/providers/Microsoft.Advisor/") + server.CountRequests("/providers/Microsoft.Security/"); queries != 2 {
+		t.Errorf("Expected recommendations and scores to be queried once, got %d queries", queries)
+	}
+}
@@ -0,0 +1,195 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/credativ/azure_metrics_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AzureAppInsightsMetricResponse represents the value of a metric returned by the
+// Application Insights metrics API.
+type AzureAppInsightsMetricResponse struct {
+	Value AzureAppInsightsSegment `json:"value"`
+}
+
+// AzureAppInsightsSegment is the result of a metric query or one of its segments. Besides
+// start, end and nested segments, it holds the value of the segment keyed by the segment
+// name and the aggregated values keyed by the metric ID.
+type AzureAppInsightsSegment map[string]interface{}
+
+// Segments returns the nested segments.
+func (s AzureAppInsightsSegment) Segments() []AzureAppInsightsSegment {
+	list, _ := s["segments"].([]interface{})
+	var segments []AzureAppInsightsSegment
+	for _, item := range list {
+		if m, ok := item.(map[string]interface{}); ok {
+			segments = append(segments, AzureAppInsightsSegment(m))
+		}
+	}
+	return segments
+}
+
+// Aggregation returns the value of a metric aggregated by the Application Insights
+// aggregation name, e.g. avg, or nil if there is none.
+func (s AzureAppInsightsSegment) Aggregation(metricID string, aggregation string) *float64 {
+	values, _ := s[metricID].(map[string]interface{})
+	value, ok := values[aggregation].(float64)
+	if !ok {
+		return nil
+	}
+	return &value
+}
+
+// appInsightsAggregations maps aggregations to their names in the Application Insights API.
+var appInsightsAggregations = map[string]string{
+	"Total":   "sum",
+	"Average": "avg",
+	"Minimum": "min",
+	"Maximum": "max",
+}
+
+// GetAppInsightsMetric returns the value of a metric of an Application Insights app in the
+// current time window, optionally split by segments.
+func (ac *AzureClient) GetAppInsightsMetric(appID string, metricID string, aggregations []string, segments []string) (AzureAppInsightsMetricResponse, error) {
+	endTime, startTime := GetTimes(MetricWindow)
+
+	if len(aggregations) == 0 {
+		aggregations = []string{"Total", "Average", "Minimum", "Maximum"}
+	}
+	var names []string
+	for _, a := range aggregations {
+		names = append(names, appInsightsAggregations[a])
+	}
+
+	values := url.Values{}
+	values.Add("timespan", fmt.Sprintf("%s/%s", startTime, endTime))
+	values.Add("aggregation", strings.Join(names, ","))
+	if len(segments) > 0 {
+		values.Add("segment", strings.Join(segments, ","))
+	}
+	endpoint := fmt.Sprintf("https://api.applicationinsights.io/v1/apps/%s/metrics/%s?%s", appID, metricID, values.Encode())
+
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return AzureAppInsightsMetricResponse{}, fmt.Errorf("Error creating HTTP request: %v", err)
+	}
+	body, err := ac.doJSON(req, appInsightsResource)
+	if err != nil {
+		return AzureAppInsightsMetricResponse{}, fmt.Errorf("Unable to query application insights API: %v", err)
+	}
+
+	var data AzureAppInsightsMetricResponse
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		return AzureAppInsightsMetricResponse{}, fmt.Errorf("Error unmarshalling response body: %v", err)
+	}
+	return data, nil
+}
+
+// collectAppInsights exports the metrics of an Application Insights component like
+// collectResource does, with segments exported as dimension labels.
+func (c *Collector) collectAppInsights(ch chan<- prometheus.Metric, target AzureResource, app config.AppInsights) {
+	resourceID, err := ParseResourceID(target.Id)
+	if err != nil {
+		log.Printf("Failed to parse target %s: %v", target.Id, err)
+		return
+	}
+	labels := CreateResourceLabels(resourceID)
+	AddTagLabels(labels, target.Tags, c.config.TagLabels)
+
+	// Units are only known for the standard metrics, which are also served by the resource manager API.
+	// Without the definitions, it is unknown which metrics are custom ones, so none are collected.
+	definitions, err := c.client.GetMetricDefinitions(resourceID, "")
+	if err != nil {
+		log.Printf("Failed to get metric definitions for target %s: %v", target.Id, err)
+		c.metrics.collectMissing(ch, labels, app.Metrics)
+		return
+	}
+	units := make(map[string]string)
+	for _, d := range definitions.MetricDefinitionResponses {
+		units[strings.ToLower(d.Name.Value)] = d.Unit
+	}
+
+	var missing []string
+	for _, metricID := range app.Metrics {
+		data, err := c.client.GetAppInsightsMetric(app.AppID, metricID, app.Aggregations, app.Segments)
+		if err != nil {
+			log.Printf("Failed to get metric %s for target %s: %v", metricID, target.Id, err)
+			missing = append(missing, metricID)
+			continue
+		}
+
+		unit, ok := units[strings.ToLower(metricID)]
+		if !ok {
+			unit = "Unspecified"
+		}
+		// The prefix keeps series apart from those of the resource manager API, which may
+		// serve the same metric with other labels. Metric IDs are namespaced by "/", as in
+		// requests/count, which is not a rate like in the names of Azure Monitor metrics.
+		metricName := "azure_app_insights_" + PrometheusMetricName(strings.Replace(metricID, "/", "_", -1), unit)
+
+		collected := false
+		var collect func(segment AzureAppInsightsSegment, labels map[string]string)
+		collect = func(segment AzureAppInsightsSegment, labels map[string]string) {
+			if nested := segment.Segments(); len(nested) > 0 {
+				for _, s := range nested {
+					collect(s, appInsightsSegmentLabels(labels, s, app.Segments))
+				}
+				return
+			}
+
+			for _, s := range metricSuffixes {
+				if !hasAggregation(app.Aggregations, s.aggregation) {
+					continue
+				}
+				v := segment.Aggregation(metricID, appInsightsAggregations[s.aggregation])
+				if v == nil {
+					continue
+				}
+				collected = true
+
+				ch <- prometheus.MustNewConstMetric(
+					prometheus.NewDesc(metricName+s.suffix, metricName+s.suffix, nil, labels),
+					prometheus.GaugeValue,
+					*v,
+				)
+			}
+		}
+		collect(data.Value, appInsightsSegmentLabels(labels, data.Value, app.Segments))
+
+		if !collected {
+			missing = append(missing, metricID)
+		}
+	}
+
+	if len(missing) > 0 {
+		log.Printf("No data returned for metrics %s at target %s", strings.Join(missing, ","), target.Id)
+		c.metrics.collectMissing(ch, labels, missing)
+	}
+}
+
+// appInsightsSegmentLabels returns labels with a dimension label added for each of the
+// segments the segment is split by. All series of a metric get the labels of all
+// segments, as Application Insights omits segments without a value.
+func appInsightsSegmentLabels(labels map[string]string, segment AzureAppInsightsSegment, segments []string) map[string]string {
+	result := make(map[string]string, len(labels)+len(segments))
+	for k, v := range labels {
+		result[k] = v
+	}
+	for _, name := range segments {
+		label := "dimension_" + strings.ToLower(invalidLabelChars.ReplaceAllString(name, "_"))
+		if _, ok := result[label]; !ok {
+			result[label] = ""
+		}
+		if value, ok := segment[name]; ok && value != nil {
+			result[label] = fmt.Sprint(value)
+		}
+	}
+	return result
+}
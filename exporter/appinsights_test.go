@@ -0,0 +1,104 @@
+package exporter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/credativ/azure_metrics_exporter/azuretest"
+)
+
+const (
+	testApp   = "/subscriptions/" + testSubscription + "/resourceGroups/web/providers/Microsoft.Insights/components/shop"
+	testAppID = "5a6b7c8d-9e0f-4a1b-8c2d-3e4f5a6b7c8d"
+)
+
+func TestCollectAppInsights(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+app_insights:
+  - name: /resourceGroups/web/providers/Microsoft.Insights/components/shop
+    app_id: `+testAppID+`
+    metrics:
+      - requests/count
+      - customMetrics/checkout_duration
+      - exceptions/count
+    aggregations:
+      - Total
+      - Average
+    segments:
+      - request/resultCode
+      - cloud/roleName
+`)
+	server.AddResource(azuretest.Resource{ID: testApp, Location: "westeurope", Kind: "web"})
+	server.AddMetricDefinitions("Microsoft.Insights/components",
+		azuretest.MetricDefinition{Name: "requests/count", Unit: "Count", PrimaryAggregation: "Count"},
+	)
+	server.SetAppInsightsMetric(testAppID, "requests/count",
+		azuretest.AppInsightsSeries{Segments: map[string]string{"request/resultCode": "200", "cloud/roleName": "frontend"}, Values: map[string]float64{"sum": 90, "avg": 1}},
+		azuretest.AppInsightsSeries{Segments: map[string]string{"request/resultCode": "500", "cloud/roleName": "frontend"}, Values: map[string]float64{"sum": 3, "avg": 1}},
+		azuretest.AppInsightsSeries{Segments: map[string]string{"request/resultCode": "200"}, Values: map[string]float64{"sum": 10, "avg": 1}},
+	)
+	server.SetAppInsightsMetric(testAppID, "customMetrics/checkout_duration",
+		azuretest.AppInsightsSeries{Segments: map[string]string{"cloud/roleName": "backend"}, Values: map[string]float64{"avg": 250, "sum": 500}},
+	)
+
+	metrics := gather(t, NewCollector(cfg, client))
+
+	requests := make(map[string]float64)
+	for _, m := range metrics["azure_app_insights_requests_count_count_total"] {
+		labels := labelMap(m)
+		if labels["resource_name"] != "shop" || labels["resource_type"] != "Microsoft.Insights/components" {
+			t.Errorf("Unexpected resource labels: %v", labels)
+		}
+		requests[labels["dimension_request_resultcode"]+"/"+labels["dimension_cloud_rolename"]] = m.GetGauge().GetValue()
+	}
+	if len(requests) != 3 || requests["200/frontend"] != 90 || requests["500/frontend"] != 3 || requests["200/"] != 10 {
+		t.Errorf("Unexpected requests: %v", requests)
+	}
+
+	durations := metrics["azure_app_insights_custommetrics_checkout_duration_unspecified_average"]
+	if len(durations) != 1 || durations[0].GetGauge().GetValue() != 250 || labelMap(durations[0])["dimension_request_resultcode"] != "" {
+		t.Errorf("Unexpected checkout durations: %v", durations)
+	}
+
+	missing := metrics["azure_metric_missing"]
+	if len(missing) != 1 || labelMap(missing[0])["metric"] != "exceptions/count" {
+		t.Errorf("Expected exceptions/count to be missing, got %v", missing)
+	}
+
+	if len(metrics["azure_resource_info"]) != 1 {
+		t.Errorf("Expected resource info of the component, got %v", metrics["azure_resource_info"])
+	}
+}
+
+// failingDefinitionsAPI fails to return metric definitions and otherwise uses an AzureClient.
+type failingDefinitionsAPI struct {
+	*AzureClient
+}
+
+func (failingDefinitionsAPI) GetMetricDefinitions(*ResourceID, string) (AzureMetricDefinitionResponse, error) {
+	return AzureMetricDefinitionResponse{}, fmt.Errorf("Unable to query metric definitions API with status code: 500")
+}
+
+func TestCollectAppInsightsWithoutDefinitions(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+app_insights:
+  - name: /resourceGroups/web/providers/Microsoft.Insights/components/shop
+    app_id: `+testAppID+`
+    metrics:
+      - requests/count
+`)
+	server.AddResource(azuretest.Resource{ID: testApp, Location: "westeurope", Kind: "web"})
+	server.SetAppInsightsMetric(testAppID, "requests/count",
+		azuretest.AppInsightsSeries{Values: map[string]float64{"sum": 90}},
+	)
+
+	metrics := gather(t, NewCollector(cfg, failingDefinitionsAPI{client}))
+
+	if got := metrics["azure_app_insights_requests_count_unspecified_total"]; len(got) != 0 {
+		t.Errorf("Expected no metric with an unknown unit, got %v", got)
+	}
+	missing := metrics["azure_metric_missing"]
+	if len(missing) != 1 || labelMap(missing[0])["metric"] != "requests/count" {
+		t.Errorf("Expected requests/count to be missing, got %v", missing)
+	}
+}
@@ -0,0 +1,781 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/credativ/azure_metrics_exporter/config"
+)
+
+// AzureMetricDefinitionResponse represents metric definition response for a given resource from Azure.
+type AzureMetricDefinitionResponse struct {
+	MetricDefinitionResponses []AzureMetricDefinition `json:"value"`
+}
+
+// AzureMetricNamespaceResponse represents the metric namespaces of a resource.
+type AzureMetricNamespaceResponse struct {
+	Value []struct {
+		ID             string `json:"id"`
+		Name           string `json:"name"`
+		Classification string `json:"classification"`
+		Properties     struct {
+			MetricNamespaceName string `json:"metricNamespaceName"`
+		} `json:"properties"`
+	} `json:"value"`
+}
+
+// AzureMetricDefinition represents the definition of a single metric.
+type AzureMetricDefinition struct {
+	Dimensions []struct {
+		LocalizedValue string `json:"localizedValue"`
+		Value          string `json:"value"`
+	} `json:"dimensions"`
+	ID                   string `json:"id"`
+	IsDimensionRequired  bool   `json:"isDimensionRequired"`
+	MetricAvailabilities []struct {
+		Retention string `json:"retention"`
+		TimeGrain string `json:"timeGrain"`
+	} `json:"metricAvailabilities"`
+	Name struct {
+		LocalizedValue string `json:"localizedValue"`
+		Value          string `json:"value"`
+	} `json:"name"`
+	PrimaryAggregationType    string   `json:"primaryAggregationType"`
+	SupportedAggregationTypes []string `json:"supportedAggregationTypes"`
+	ResourceID                string   `json:"resourceId"`
+	Unit                      string   `json:"unit"`
+}
+
+// AzureMetricValueResponse represents a metric value response for a given metric definition.
+type AzureMetricValueResponse struct {
+	Value []struct {
+		Timeseries []AzureTimeseries `json:"timeseries"`
+		ID         string            `json:"id"`
+		Name       struct {
+			LocalizedValue string `json:"localizedValue"`
+			Value          string `json:"value"`
+		} `json:"name"`
+		Type string `json:"type"`
+		Unit string `json:"unit"`
+	} `json:"value"`
+	APIError struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// AzureTimeseries represents the values of a metric for one combination of dimension values.
+type AzureTimeseries struct {
+	Metadatavalues []struct {
+		Name struct {
+			LocalizedValue string `json:"localizedValue"`
+			Value          string `json:"value"`
+		} `json:"name"`
+		Value string `json:"value"`
+	} `json:"metadatavalues"`
+	Data []AzureDataPoint `json:"data"`
+}
+
+// AzureDataPoint represents the aggregated values of a metric in one time grain.
+// Azure omits aggregations without data in the time grain, which are nil here.
+type AzureDataPoint struct {
+	TimeStamp string   `json:"timeStamp"`
+	Total     *float64 `json:"total"`
+	Average   *float64 `json:"average"`
+	Minimum   *float64 `json:"minimum"`
+	Maximum   *float64 `json:"maximum"`
+}
+
+// Aggregation returns the value of an aggregation type, or nil if it is absent.
+func (p AzureDataPoint) Aggregation(aggregation string) *float64 {
+	switch aggregation {
+	case "Total":
+		return p.Total
+	case "Average":
+		return p.Average
+	case "Minimum":
+		return p.Minimum
+	case "Maximum":
+		return p.Maximum
+	}
+	return nil
+}
+
+// AzureResource represents a single resource as returned by the Azure resource list API.
+type AzureResource struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	ManagedBy string `json:"managedBy"`
+	Location  string `json:"location"`
+	Kind      string `json:"kind"`
+	Sku       struct {
+		Name string `json:"name"`
+		Tier string `json:"tier"`
+	} `json:"sku"`
+	Tags map[string]string `json:"tags"`
+}
+
+// AzureResourceListResponse represents a resource list response for a given resource group.
+type AzureResourceListResponse struct {
+	Value    []AzureResource `json:"value"`
+	NextLink string          `json:"nextLink"`
+}
+
+// How long resource metadata of explicitly configured resources is cached.
+const resourceCacheTTL = 10 * time.Minute
+
+type resourceCacheEntry struct {
+	resource  AzureResource
+	expiresOn time.Time
+}
+
+// How long metric definitions are cached per resource type.
+const definitionCacheTTL = time.Hour
+
+type definitionCacheEntry struct {
+	definitions AzureMetricDefinitionResponse
+	expiresOn   time.Time
+}
+
+// ResourceLookupAPI is the part of the Azure API used to look up configured resources.
+type ResourceLookupAPI interface {
+	// GetResource returns the metadata of a single resource.
+	GetResource(resourceID *ResourceID) (AzureResource, error)
+}
+
+// ResourceListAPI is the part of the Azure API used to select the resources of resource groups.
+type ResourceListAPI interface {
+	// ListFromResourceGroup lists the resources of the given types in a resource group.
+	ListFromResourceGroup(resourceGroup string, resourceTypes []string) ([]AzureResource, error)
+	// ListFromSubscription lists the resources of the given types in all resource groups.
+	ListFromSubscription(resourceTypes []string) ([]AzureResource, error)
+	// ListResourceGroups returns the names of all resource groups.
+	ListResourceGroups() ([]string, error)
+}
+
+// ResourceAPI is the part of the Azure API used to find the configured resources.
+type ResourceAPI interface {
+	ResourceLookupAPI
+	ResourceListAPI
+}
+
+// MetricAPI is the part of the Azure API used to collect the metrics of resources.
+type MetricAPI interface {
+	// GetMetricNamespaces returns the metric namespaces of a resource.
+	GetMetricNamespaces(resourceID *ResourceID) (AzureMetricNamespaceResponse, error)
+	// GetMetricDefinitions returns the metrics defined for a resource in a namespace, "" being the default.
+	GetMetricDefinitions(resourceID *ResourceID, namespace string) (AzureMetricDefinitionResponse, error)
+	// GetMetricValues returns the values of a comma separated list of metrics of a resource
+	// per time grain in the given time window before the current time.
+	GetMetricValues(resource string, namespace string, metricNames string, aggregations []string, timeGrain time.Duration, window time.Duration) (AzureMetricValueResponse, error)
+}
+
+// ProbeAPI is the part of the Azure API used by ProbeCollector.
+type ProbeAPI interface {
+	ResourceLookupAPI
+	MetricAPI
+}
+
+// HealthAPI is the part of the Azure API used to collect the Resource Health of resources.
+type HealthAPI interface {
+	// GetAvailabilityStatus returns the current Resource Health status of a resource.
+	GetAvailabilityStatus(resource string) (AzureAvailabilityStatusResponse, error)
+}
+
+// AppInsightsAPI is the part of the Azure API used to collect Application Insights metrics.
+type AppInsightsAPI interface {
+	// GetAppInsightsMetric returns the current value of a metric of an Application Insights app.
+	GetAppInsightsMetric(appID string, metricID string, aggregations []string, segments []string) (AzureAppInsightsMetricResponse, error)
+}
+
+// QuotaAPI is the part of the Azure API used to collect subscription quotas.
+type QuotaAPI interface {
+	// GetUsages returns the usage and limits of the subscription quotas of a provider in a location.
+	GetUsages(provider string, location string) (AzureUsageListResponse, error)
+}
+
+// ActivityLogAPI is the part of the Azure API used to count Activity Log events.
+type ActivityLogAPI interface {
+	// ListActivityLogEvents returns the Activity Log events between from and to matching an OData filter.
+	ListActivityLogEvents(from time.Time, to time.Time, filter string) ([]AzureActivityLogEvent, error)
+}
+
+// AdvisorAPI is the part of the Azure API used to collect Advisor recommendations and secure scores.
+type AdvisorAPI interface {
+	// ListAdvisorRecommendations returns the Advisor recommendations, reusing results up to maxAge old.
+	ListAdvisorRecommendations(maxAge time.Duration) ([]AzureAdvisorRecommendation, error)
+	// ListSecureScores returns the secure scores, reusing results up to maxAge old.
+	ListSecureScores(maxAge time.Duration) ([]AzureSecureScore, error)
+}
+
+// LogQueryAPI is the part of the Azure API used to collect the results of log queries.
+type LogQueryAPI interface {
+	// QueryLogs runs a Log Analytics query, reusing results up to maxAge old.
+	QueryLogs(workspaceID string, query string, timespan string, maxAge time.Duration) (AzureLogQueryResponse, error)
+}
+
+// CostAPI is the part of the Azure API used to collect costs.
+type CostAPI interface {
+	// QueryCost runs a Cost Management query for a scope, reusing results up to maxAge old.
+	QueryCost(scope string, query AzureCostQuery, maxAge time.Duration) (AzureCostQueryResponse, error)
+}
+
+// AzureAPI is the part of the Azure API used by the collectors. It is implemented
+// by AzureClient and can be replaced, e.g. in tests. Code needing only part of it
+// uses the smaller interfaces it consists of.
+type AzureAPI interface {
+	// RefreshAccessToken returns a valid access token, getting a new one if needed.
+	RefreshAccessToken() (string, error)
+	ResourceAPI
+	MetricAPI
+	HealthAPI
+	AppInsightsAPI
+	QuotaAPI
+	ActivityLogAPI
+	AdvisorAPI
+	LogQueryAPI
+	CostAPI
+}
+
+// AzureClient represents our client to talk to the Azure api
+type AzureClient struct {
+	client      *http.Client
+	credentials config.Credentials
+
+	tokenMutex   sync.Mutex
+	accessTokens map[string]accessToken
+
+	resourceCacheMutex sync.Mutex
+	resourceCache      map[string]resourceCacheEntry
+
+	definitionCacheMutex sync.Mutex
+	definitionCache      map[string]definitionCacheEntry
+
+	slowCacheMutex sync.Mutex
+	slowCache      map[string]slowCacheEntry
+	refreshes      map[string]*slowCacheRefresh
+}
+
+// NewAzureClient returns an Azure client to talk the Azure API with the given
+// credentials. Requests are sent with client, which may be shared between Azure clients.
+func NewAzureClient(credentials config.Credentials, client *http.Client) *AzureClient {
+	return &AzureClient{
+		client:          client,
+		credentials:     credentials,
+		accessTokens:    make(map[string]accessToken),
+		resourceCache:   make(map[string]resourceCacheEntry),
+		definitionCache: make(map[string]definitionCacheEntry),
+		slowCache:       make(map[string]slowCacheEntry),
+		refreshes:       make(map[string]*slowCacheRefresh),
+	}
+}
+
+// Resources access tokens are requested for.
+const (
+	managementResource   = "https://management.azure.com/"
+	logAnalyticsResource = "https://api.loganalytics.io"
+	appInsightsResource  = "https://api.applicationinsights.io"
+)
+
+type accessToken struct {
+	value     string
+	expiresOn time.Time
+}
+
+// RefreshAccessToken returns the current access token for the resource manager API,
+// getting a new one if it expires within the next 10 minutes.
+func (ac *AzureClient) RefreshAccessToken() (string, error) {
+	return ac.refreshAccessToken(managementResource)
+}
+
+// refreshAccessToken returns the current access token for resource, getting a new one
+// if it expires within the next 10 minutes.
+func (ac *AzureClient) refreshAccessToken(resource string) (string, error) {
+	ac.tokenMutex.Lock()
+	defer ac.tokenMutex.Unlock()
+
+	token := ac.accessTokens[resource]
+	now := time.Now().UTC()
+	refreshAt := token.expiresOn.Add(-10 * time.Minute)
+	if now.After(refreshAt) {
+		var err error
+		token, err = ac.getAccessToken(resource)
+		if err != nil {
+			return "", fmt.Errorf("Error refreshing access token: %v", err)
+		}
+		ac.accessTokens[resource] = token
+	}
+
+	return token.value, nil
+}
+
+// getAccessToken gets a new access token for resource.
+func (ac *AzureClient) getAccessToken(resource string) (accessToken, error) {
+	credentials := ac.credentials
+	target := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/token", credentials.TenantID)
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"resource":      {resource},
+		"client_id":     {credentials.ClientID},
+		"client_secret": {credentials.ClientSecret},
+	}
+	resp, err := ac.client.PostForm(target, form)
+	if err != nil {
+		return accessToken{}, fmt.Errorf("Error authenticating against Azure API: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return accessToken{}, fmt.Errorf("Did not get status code 200, got: %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return accessToken{}, fmt.Errorf("Error reading body of response: %v", err)
+	}
+	var data map[string]interface{}
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		return accessToken{}, fmt.Errorf("Error unmarshalling response body: %v", err)
+	}
+	expiresOn, err := strconv.ParseInt(data["expires_on"].(string), 10, 64)
+	if err != nil {
+		return accessToken{}, fmt.Errorf("Error ParseInt of expires_on failed: %v", err)
+	}
+	return accessToken{
+		value:     data["access_token"].(string),
+		expiresOn: time.Unix(expiresOn, 0).UTC(),
+	}, nil
+}
+
+// getMetricDefinition returns the metric definitions of a single resource in a metric
+// namespace, or in the default namespace if it is empty.
+func (ac *AzureClient) getMetricDefinition(resource string, namespace string) (AzureMetricDefinitionResponse, error) {
+	apiVersion := "2018-01-01"
+	accessToken, err := ac.RefreshAccessToken()
+	if err != nil {
+		return AzureMetricDefinitionResponse{}, err
+	}
+
+	values := url.Values{}
+	if namespace != "" {
+		values.Add("metricnamespace", namespace)
+	}
+	values.Add("api-version", apiVersion)
+	metricsTarget := fmt.Sprintf("https://management.azure.com%s/providers/microsoft.insights/metricDefinitions?%s", resource, values.Encode())
+	req, err := http.NewRequest("GET", metricsTarget, nil)
+	if err != nil {
+		return AzureMetricDefinitionResponse{}, fmt.Errorf("Error creating HTTP request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := ac.client.Do(req)
+	if err != nil {
+		return AzureMetricDefinitionResponse{}, fmt.Errorf("Error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return AzureMetricDefinitionResponse{}, fmt.Errorf("Error reading body of response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return AzureMetricDefinitionResponse{}, fmt.Errorf("Error: %v", string(body))
+	}
+
+	def := AzureMetricDefinitionResponse{}
+	err = json.Unmarshal(body, &def)
+	if err != nil {
+		return AzureMetricDefinitionResponse{}, fmt.Errorf("Error unmarshalling response body: %v", err)
+	}
+	return def, nil
+}
+
+// GetMetricDefinitions returns the metric definitions of a resource in a metric namespace,
+// or in the default namespace if it is empty. As all resources of a type define the same
+// platform metrics, the result is cached per type for the default namespace. Other namespaces,
+// such as those of guest or custom metrics, may differ between resources and are cached per
+// resource.
+func (ac *AzureClient) GetMetricDefinitions(resourceID *ResourceID, namespace string) (AzureMetricDefinitionResponse, error) {
+	key := strings.ToLower(resourceID.ResourceType)
+	if namespace != "" {
+		key = strings.ToLower(resourceID.ID + "|" + namespace)
+	}
+
+	ac.definitionCacheMutex.Lock()
+	entry, ok := ac.definitionCache[key]
+	ac.definitionCacheMutex.Unlock()
+	if ok && time.Now().Before(entry.expiresOn) {
+		return entry.definitions, nil
+	}
+
+	def, err := ac.getMetricDefinition(resourceID.ID, namespace)
+	if err != nil {
+		return AzureMetricDefinitionResponse{}, err
+	}
+
+	ac.definitionCacheMutex.Lock()
+	ac.definitionCache[key] = definitionCacheEntry{
+		definitions: def,
+		expiresOn:   time.Now().Add(definitionCacheTTL),
+	}
+	ac.definitionCacheMutex.Unlock()
+
+	return def, nil
+}
+
+// GetMetricNamespaces returns the metric namespaces of a resource, such as the platform
+// metrics of its type and custom or guest metrics.
+func (ac *AzureClient) GetMetricNamespaces(resourceID *ResourceID) (AzureMetricNamespaceResponse, error) {
+	apiVersion := "2017-12-01-preview"
+	endpoint := fmt.Sprintf("https://management.azure.com%s/providers/microsoft.insights/metricNamespaces?api-version=%s", resourceID.ID, apiVersion)
+
+	body, err := ac.getJSON(endpoint)
+	if err != nil {
+		return AzureMetricNamespaceResponse{}, fmt.Errorf("Unable to query metric namespaces API: %v", err)
+	}
+
+	var data AzureMetricNamespaceResponse
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		return AzureMetricNamespaceResponse{}, fmt.Errorf("Error unmarshalling response body: %v", err)
+	}
+	return data, nil
+}
+
+// GetMetricValues returns the values of the given metrics of a resource per time grain in the
+// time window before the current time. The time grain must be supported by all of the metrics.
+// Metrics are looked up in namespace, or in the default namespace if it is empty.
+func (ac *AzureClient) GetMetricValues(resource string, namespace string, metricNames string, aggregations []string, timeGrain time.Duration, window time.Duration) (AzureMetricValueResponse, error) {
+	apiVersion := "2018-01-01"
+	accessToken, err := ac.RefreshAccessToken()
+	if err != nil {
+		return AzureMetricValueResponse{}, err
+	}
+
+	endTime, startTime := GetTimes(window)
+
+	metricValueEndpoint := fmt.Sprintf("https://management.azure.com%s/providers/microsoft.insights/metrics", resource)
+
+	req, err := http.NewRequest("GET", metricValueEndpoint, nil)
+	if err != nil {
+		return AzureMetricValueResponse{}, fmt.Errorf("Error creating HTTP request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	values := url.Values{}
+	if namespace != "" {
+		values.Add("metricnamespace", namespace)
+	}
+	if metricNames != "" {
+		values.Add("metricnames", metricNames)
+	}
+	if len(aggregations) > 0 {
+		values.Add("aggregation", strings.Join(aggregations, ","))
+	} else {
+		values.Add("aggregation", "Total,Average,Minimum,Maximum")
+	}
+	values.Add("timespan", fmt.Sprintf("%s/%s", startTime, endTime))
+	values.Add("interval", formatTimeGrain(timeGrain))
+	values.Add("api-version", apiVersion)
+
+	req.URL.RawQuery = values.Encode()
+
+	log.Printf("GET %s", req.URL)
+	resp, err := ac.client.Do(req)
+	if err != nil {
+		return AzureMetricValueResponse{}, fmt.Errorf("Error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return AzureMetricValueResponse{}, fmt.Errorf("Unable to query metrics API with status code: %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return AzureMetricValueResponse{}, fmt.Errorf("Error reading body of response: %v", err)
+	}
+
+	var data AzureMetricValueResponse
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		return AzureMetricValueResponse{}, fmt.Errorf("Error unmarshalling response body: %v", err)
+	}
+
+	return data, nil
+}
+
+// ListFromResourceGroup lists the resources of the given types in a resource group.
+func (ac *AzureClient) ListFromResourceGroup(resourceGroup string, resourceTypes []string) ([]AzureResource, error) {
+	return ac.listResources(fmt.Sprintf("/resourceGroups/%s", resourceGroup), resourceTypes)
+}
+
+// ListFromSubscription lists the resources of the given types in all resource groups of the subscription.
+func (ac *AzureClient) ListFromSubscription(resourceTypes []string) ([]AzureResource, error) {
+	return ac.listResources("", resourceTypes)
+}
+
+// listResources lists the resources of the given types within a scope relative to the subscription.
+func (ac *AzureClient) listResources(scope string, resourceTypes []string) ([]AzureResource, error) {
+	apiVersion := "2018-02-01"
+
+	var filterTypesElements []string
+	for _, filterType := range resourceTypes {
+		filterTypesElements = append(filterTypesElements, fmt.Sprintf("resourcetype eq '%s'", filterType))
+	}
+	filterTypes := url.QueryEscape(strings.Join(filterTypesElements, " or "))
+
+	subscription := fmt.Sprintf("subscriptions/%s", ac.credentials.SubscriptionID)
+
+	resourcesEndpoint := fmt.Sprintf("https://management.azure.com/%s%s/resources?api-version=%s&$filter=%s", subscription, scope, apiVersion, filterTypes)
+
+	var resources []AzureResource
+	for resourcesEndpoint != "" {
+		body, err := ac.getJSON(resourcesEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to query resource list API: %v", err)
+		}
+
+		var data AzureResourceListResponse
+		err = json.Unmarshal(body, &data)
+		if err != nil {
+			return nil, fmt.Errorf("Error unmarshalling response body: %v", err)
+		}
+		resources = append(resources, data.Value...)
+		resourcesEndpoint = data.NextLink
+	}
+
+	return resources, nil
+}
+
+// AzureResourceGroupListResponse represents the response of the resource group list API.
+type AzureResourceGroupListResponse struct {
+	Value []struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Location string `json:"location"`
+	} `json:"value"`
+	NextLink string `json:"nextLink"`
+}
+
+// ListResourceGroups returns the names of all resource groups in the subscription.
+func (ac *AzureClient) ListResourceGroups() ([]string, error) {
+	apiVersion := "2018-02-01"
+	subscription := fmt.Sprintf("subscriptions/%s", ac.credentials.SubscriptionID)
+	endpoint := fmt.Sprintf("https://management.azure.com/%s/resourcegroups?api-version=%s", subscription, apiVersion)
+
+	var groups []string
+	for endpoint != "" {
+		body, err := ac.getJSON(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to query resource group list API: %v", err)
+		}
+
+		var data AzureResourceGroupListResponse
+		err = json.Unmarshal(body, &data)
+		if err != nil {
+			return nil, fmt.Errorf("Error unmarshalling response body: %v", err)
+		}
+		for _, group := range data.Value {
+			groups = append(groups, group.Name)
+		}
+		endpoint = data.NextLink
+	}
+	return groups, nil
+}
+
+// Results of cached that were not asked for this long are dropped, e.g. those of cost
+// queries for a previous day.
+const slowCacheRetention = 24 * time.Hour
+
+type slowCacheEntry struct {
+	value     interface{}
+	fetchedAt time.Time
+	usedAt    time.Time
+}
+
+// cached returns the result of fetch, reusing it for maxAge. This is meant for slowly
+// changing data, so if fetch fails, the previous result is used as long as there is one.
+func (ac *AzureClient) cached(key string, maxAge time.Duration, fetch func() (interface{}, error)) (interface{}, error) {
+	ac.slowCacheMutex.Lock()
+	entry, ok := ac.slowCache[key]
+	if ok {
+		entry.usedAt = time.Now()
+		ac.slowCache[key] = entry
+	}
+	ac.slowCacheMutex.Unlock()
+	if ok && time.Since(entry.fetchedAt) < maxAge {
+		return entry.value, nil
+	}
+
+	value, err := fetch()
+	if err != nil {
+		if ok {
+			log.Printf("Failed to refresh %s, using result from %s: %v", key, entry.fetchedAt.Format(time.RFC3339), err)
+			return entry.value, nil
+		}
+		return nil, err
+	}
+
+	ac.slowCacheMutex.Lock()
+	ac.storeCached(key, value)
+	ac.slowCacheMutex.Unlock()
+	return value, nil
+}
+
+// storeCached stores a result of cached. Callers must hold slowCacheMutex.
+func (ac *AzureClient) storeCached(key string, value interface{}) {
+	for k, e := range ac.slowCache {
+		if time.Since(e.usedAt) > slowCacheRetention {
+			delete(ac.slowCache, k)
+		}
+	}
+	ac.slowCache[key] = slowCacheEntry{value: value, fetchedAt: time.Now(), usedAt: time.Now()}
+}
+
+type slowCacheRefresh struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// cachedInBackground is like cached, but fetches in the background, so callers don't wait
+// for slow APIs. Once maxAge has passed, the previous result is returned while it is being
+// refreshed. Without a previous result, callers wait for the fetch for at most wait.
+func (ac *AzureClient) cachedInBackground(key string, maxAge time.Duration, wait time.Duration, fetch func() (interface{}, error)) (interface{}, error) {
+	ac.slowCacheMutex.Lock()
+	entry, ok := ac.slowCache[key]
+	if ok {
+		entry.usedAt = time.Now()
+		ac.slowCache[key] = entry
+		if time.Since(entry.fetchedAt) < maxAge {
+			ac.slowCacheMutex.Unlock()
+			return entry.value, nil
+		}
+	}
+
+	refresh, refreshing := ac.refreshes[key]
+	if !refreshing {
+		refresh = &slowCacheRefresh{done: make(chan struct{})}
+		ac.refreshes[key] = refresh
+		go func() {
+			value, err := fetch()
+
+			ac.slowCacheMutex.Lock()
+			defer ac.slowCacheMutex.Unlock()
+			if err != nil {
+				if previous, ok := ac.slowCache[key]; ok {
+					log.Printf("Failed to refresh %s, using result from %s: %v", key, previous.fetchedAt.Format(time.RFC3339), err)
+				}
+			} else {
+				ac.storeCached(key, value)
+			}
+			refresh.value, refresh.err = value, err
+			delete(ac.refreshes, key)
+			close(refresh.done)
+		}()
+	}
+	ac.slowCacheMutex.Unlock()
+
+	if ok {
+		return entry.value, nil
+	}
+
+	select {
+	case <-refresh.done:
+		return refresh.value, refresh.err
+	case <-time.After(wait):
+		return nil, fmt.Errorf("No result yet, still fetching %s", key)
+	}
+}
+
+// getJSON performs an authenticated GET request against the Azure API and returns the response body.
+func (ac *AzureClient) getJSON(endpoint string) ([]byte, error) {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating HTTP request: %v", err)
+	}
+	return ac.doJSON(req, managementResource)
+}
+
+// postJSON performs a POST request with body encoded as JSON, authenticated for resource,
+// and returns the response body.
+func (ac *AzureClient) postJSON(resource string, endpoint string, body interface{}) ([]byte, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling request body: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Error creating HTTP request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return ac.doJSON(req, resource)
+}
+
+// doJSON sends a request authenticated with the current access token for resource and
+// returns the response body.
+func (ac *AzureClient) doJSON(req *http.Request, resource string) ([]byte, error) {
+	accessToken, err := ac.refreshAccessToken(resource)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	log.Printf("%s %s", req.Method, req.URL)
+
+	resp, err := ac.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Unexpected status code: %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading body of response: %v", err)
+	}
+	return body, nil
+}
+
+// GetResource looks up the metadata (location, tags, ...) of a single resource.
+// Results are cached, as the resource list API has to be queried for each lookup.
+func (ac *AzureClient) GetResource(resourceID *ResourceID) (AzureResource, error) {
+	key := strings.ToLower(resourceID.ID)
+
+	ac.resourceCacheMutex.Lock()
+	entry, ok := ac.resourceCache[key]
+	ac.resourceCacheMutex.Unlock()
+	if ok && time.Now().Before(entry.expiresOn) {
+		return entry.resource, nil
+	}
+
+	resources, err := ac.ListFromResourceGroup(resourceID.ResourceGroup, []string{resourceID.ResourceType})
+	if err != nil {
+		return AzureResource{}, err
+	}
+
+	for _, resource := range resources {
+		if strings.EqualFold(resource.Id, resourceID.ID) {
+			ac.resourceCacheMutex.Lock()
+			ac.resourceCache[key] = resourceCacheEntry{
+				resource:  resource,
+				expiresOn: time.Now().Add(resourceCacheTTL),
+			}
+			ac.resourceCacheMutex.Unlock()
+			return resource, nil
+		}
+	}
+
+	return AzureResource{}, fmt.Errorf("Resource %s not found in resource group %s", resourceID.ID, resourceID.ResourceGroup)
+}
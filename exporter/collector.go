@@ -0,0 +1,331 @@
+package exporter
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/credativ/azure_metrics_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector generic collector type
+type Collector struct {
+	config  *config.Config
+	client  AzureAPI
+	metrics *metricCollector
+}
+
+// NewCollector returns a collector for the resources selected by cfg, which are
+// queried using client.
+func NewCollector(cfg *config.Config, client AzureAPI) *Collector {
+	return &Collector{
+		config:  cfg,
+		client:  client,
+		metrics: &metricCollector{config: cfg, client: client},
+	}
+}
+
+// metricCollector collects the metrics of single resources for Collector and ProbeCollector.
+type metricCollector struct {
+	config *config.Config
+	client MetricAPI
+}
+
+// Describe sends no descriptors, which makes the collector unchecked. The exported
+// metrics depend on the resources found in Azure, and several collectors can be
+// registered side by side.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+// metricSuffixes are the suffixes of the exported metrics per aggregation type.
+var metricSuffixes = []struct {
+	aggregation string
+	suffix      string
+}{
+	{"Total", "_total"},
+	{"Average", "_average"},
+	{"Minimum", "_min"},
+	{"Maximum", "_max"},
+}
+
+func (c *metricCollector) collectResource(ch chan<- prometheus.Metric, target AzureResource, namespace string, metricNames []string, aggregations []string, timeGrain time.Duration, nullPolicy func(string) string) {
+	resource := target.Id
+	resourceID, err := ParseResourceID(resource)
+	if err != nil {
+		log.Printf("Failed to parse target %s: %v", resource, err)
+		return
+	}
+	labels := CreateResourceLabels(resourceID)
+	AddTagLabels(labels, target.Tags, c.config.TagLabels)
+
+	// Older time grains are only needed for metrics falling back to their last value.
+	window := timeGrain
+	for _, name := range metricNames {
+		if nullPolicy(name) == config.NullPolicyLast {
+			window = NullPolicyLastGrains * timeGrain
+		}
+	}
+
+	metricValueData, err := c.client.GetMetricValues(resource, namespace, strings.Join(metricNames, ","), aggregations, timeGrain, window)
+	if err != nil {
+		log.Printf("Failed to get metrics for target %s: %v", resource, err)
+		c.collectMissing(ch, labels, metricNames)
+		return
+	}
+
+	// Each metric and each of its timeseries is handled on its own, as some of them
+	// may lack data, e.g. for deallocated virtual machines.
+	collected := make(map[string]bool)
+	for _, value := range metricValueData.Value {
+		metricName := PrometheusMetricName(value.Name.Value, value.Unit)
+
+		policy := nullPolicy(value.Name.Value)
+
+		for _, timeseries := range value.Timeseries {
+			seriesLabels := AddDimensionLabels(labels, timeseries)
+
+			for _, s := range metricSuffixes {
+				if !hasAggregation(aggregations, s.aggregation) {
+					continue
+				}
+
+				v := LatestValue(timeseries.Data, s.aggregation, policy)
+				if v == nil && policy != config.NullPolicyNaN {
+					continue
+				}
+				metricValue := math.NaN()
+				if v != nil {
+					metricValue = *v
+					collected[strings.ToLower(value.Name.Value)] = true
+				}
+
+				ch <- prometheus.MustNewConstMetric(
+					prometheus.NewDesc(metricName+s.suffix, metricName+s.suffix, nil, seriesLabels),
+					prometheus.GaugeValue,
+					metricValue,
+				)
+			}
+		}
+	}
+
+	var missing []string
+	for _, name := range metricNames {
+		if !collected[strings.ToLower(name)] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		log.Printf("No data returned for metrics %s at target %s", strings.Join(missing, ","), resource)
+		c.collectMissing(ch, labels, missing)
+	}
+}
+
+// collectMissing exports a signal for every metric of a resource for which no value could be collected.
+func (c *metricCollector) collectMissing(ch chan<- prometheus.Metric, labels map[string]string, metricNames []string) {
+	for _, name := range metricNames {
+		metricLabels := map[string]string{"metric": name}
+		for k, v := range labels {
+			metricLabels[k] = v
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc("azure_metric_missing", "Whether no value could be collected for an Azure metric of the resource.", nil, metricLabels),
+			prometheus.GaugeValue,
+			1,
+		)
+	}
+}
+
+// collectTarget collects the metrics selected by a target for one of its resources.
+func (c *metricCollector) collectTarget(ch chan<- prometheus.Metric, resource AzureResource, namespace string, metrics config.MetricList, aggregations []string, selects func(string) bool, nullPolicy func(string) string) {
+	resourceID, err := ParseResourceID(resource.Id)
+	if err != nil {
+		log.Printf("Failed to parse target %s: %v", resource.Id, err)
+		return
+	}
+
+	requests, err := c.resolveMetricRequests(resourceID, namespace, metrics, aggregations, selects)
+	if err != nil {
+		log.Printf("Failed to get metric definitions for target %s: %v", resource.Id, err)
+		return
+	}
+
+	for _, r := range requests {
+		c.collectResource(ch, resource, namespace, r.metrics, r.aggregations, r.timeGrain, nullPolicy)
+	}
+}
+
+// collectResourceInfo exports an info metric carrying the metadata of a resource,
+// so it can be joined onto the actual metrics.
+func (c *metricCollector) collectResourceInfo(ch chan<- prometheus.Metric, target AzureResource) {
+	resourceID, err := ParseResourceID(target.Id)
+	if err != nil {
+		return
+	}
+
+	labels := CreateResourceLabels(resourceID)
+	labels["location"] = target.Location
+	labels["sku"] = target.Sku.Name
+	labels["kind"] = target.Kind
+	AddTagLabels(labels, target.Tags, c.config.TagLabels)
+
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("azure_resource_info", "Information about the Azure resource", nil, labels),
+		prometheus.GaugeValue,
+		1,
+	)
+}
+
+// LookupResource returns the metadata of an explicitly configured resource.
+// If the lookup fails, the resource is still scraped but without tags.
+func LookupResource(client ResourceLookupAPI, resource string) AzureResource {
+	found, err := lookupResource(client, resource)
+	if err != nil {
+		log.Printf("Failed to get metadata for target %s: %v", resource, err)
+		return AzureResource{Id: resource}
+	}
+	return found
+}
+
+// lookupResource returns the metadata of a resource identified by its full ID.
+func lookupResource(client ResourceLookupAPI, resource string) (AzureResource, error) {
+	resourceID, err := ParseResourceID(resource)
+	if err != nil {
+		return AzureResource{}, err
+	}
+
+	found, err := client.GetResource(resourceID)
+	if err != nil {
+		return AzureResource{}, err
+	}
+	found.Id = resource
+
+	return found, nil
+}
+
+// Collect - collect results from Azure Montior API and create Prometheus metrics.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	// Resources may be selected by more than one target, but must only have one info metric.
+	infoCollected := make(map[string]bool)
+	locations := make(map[string]bool)
+	collectInfo := func(target AzureResource) {
+		key := strings.ToLower(target.Id)
+		if !infoCollected[key] {
+			infoCollected[key] = true
+			c.metrics.collectResourceInfo(ch, target)
+		}
+		if target.Location != "" {
+			locations[config.NormalizeLocation(target.Location)] = true
+		}
+	}
+
+	healthCollected := make(map[string]bool)
+	collectHealth := func(target AzureResource) {
+		key := strings.ToLower(target.Id)
+		if !healthCollected[key] {
+			healthCollected[key] = true
+			c.collectResourceHealth(ch, target)
+		}
+	}
+
+	// Get metric values for all defined metrics
+	for _, target := range c.config.Resources {
+		resource := LookupResource(c.client, fmt.Sprintf("/subscriptions/%s%s", c.config.Credentials.SubscriptionID, target.Name))
+
+		collectInfo(resource)
+		if target.ResourceHealth {
+			collectHealth(resource)
+		}
+		c.metrics.collectTarget(ch, resource, target.Namespace, target.Metrics, target.Aggregations, target.SelectsMetric, target.MetricNullPolicy)
+	}
+
+	for _, target := range c.config.ResourceGroups {
+		resources, err := ListResourceGroupTargets(c.client, target)
+		if err != nil {
+			log.Printf("Failed to list resources of resource group %s: %v", target.Selector(), err)
+			continue
+		}
+
+		for _, resource := range resources {
+			collectInfo(resource)
+			if target.ResourceHealth {
+				collectHealth(resource)
+			}
+			c.metrics.collectTarget(ch, resource, target.Namespace, target.Metrics, target.Aggregations, target.SelectsMetric, target.MetricNullPolicy)
+		}
+	}
+
+	for _, app := range c.config.AppInsights {
+		resource := LookupResource(c.client, fmt.Sprintf("/subscriptions/%s%s", c.config.Credentials.SubscriptionID, app.Name))
+
+		collectInfo(resource)
+		c.collectAppInsights(ch, resource, app)
+	}
+
+	c.collectCosts(ch)
+	c.collectLogQueries(ch)
+	c.collectQuotas(ch, locations)
+	c.collectAdvisor(ch)
+	c.collectSecureScore(ch)
+}
+
+// ListResourceGroupTargets returns the resources of the resource groups selected by
+// target that pass its filters.
+func ListResourceGroupTargets(client ResourceListAPI, target config.ResourceGroup) ([]AzureResource, error) {
+	var resources []AzureResource
+	switch {
+	case target.AllResourceGroups():
+		found, err := client.ListFromSubscription(target.ResourceTypes)
+		if err != nil {
+			return nil, err
+		}
+		resources = found
+	case target.IsPattern():
+		groups, err := client.ListResourceGroups()
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			if !target.MatchesGroup(group) {
+				continue
+			}
+			// A group may be deleted after it was listed, which should not hide the other groups.
+			found, err := client.ListFromResourceGroup(group, target.ResourceTypes)
+			if err != nil {
+				log.Printf("Failed to list resources of resource group %s: %v", group, err)
+				continue
+			}
+			resources = append(resources, found...)
+		}
+	default:
+		found, err := client.ListFromResourceGroup(target.Name, target.ResourceTypes)
+		if err != nil {
+			return nil, err
+		}
+		resources = found
+	}
+
+	var selected []AzureResource
+	for _, resource := range resources {
+		resourceID, err := ParseResourceID(resource.Id)
+		if err != nil {
+			log.Printf("Failed to parse resource %s: %v", resource.Id, err)
+			continue
+		}
+
+		if target.Selects(config.ResourceAttributes{
+			ID:       resource.Id,
+			Name:     resourceID.Name,
+			Type:     resourceID.ResourceType,
+			Location: resource.Location,
+			Tags:     resource.Tags,
+		}) {
+			selected = append(selected, resource)
+		}
+	}
+
+	return selected, nil
+}
@@ -0,0 +1,649 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/credativ/azure_metrics_exporter/azuretest"
+	"github.com/credativ/azure_metrics_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	testSubscription = "6a1c5f0e-0c11-4d9b-9f4e-2c2a3c5b7d01"
+	testTenant       = "9f3c1a2b-4d5e-4f60-8a7b-1c2d3e4f5a6b"
+	testClient       = "4b2e8c1d-7a3f-4e5d-9c6b-0a1b2c3d4e5f"
+	testVM           = "/subscriptions/" + testSubscription + "/resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-1"
+	testDB           = "/subscriptions/" + testSubscription + "/resourceGroups/data/providers/Microsoft.Sql/servers/sql-1/databases/orders"
+)
+
+// setupTest loads cfg as configuration and returns a fake server populated with
+// a virtual machine and a database, and a client talking to it.
+func setupTest(t *testing.T, cfg string) (*azuretest.Server, *config.Config, *AzureClient) {
+	file := filepath.Join(t.TempDir(), "azure.yml")
+	if err := ioutil.WriteFile(file, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := config.LoadConfig(file)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	server := azuretest.NewServer()
+	t.Cleanup(server.Close)
+
+	server.AddResource(azuretest.Resource{
+		ID:       testVM,
+		Location: "westeurope",
+		Sku:      "Standard_B2s",
+		Tags:     map[string]string{"Team": "web", "cost-center": "42"},
+	})
+	server.AddResource(azuretest.Resource{
+		ID:       testDB,
+		Location: "northeurope",
+		Kind:     "v12.0,user",
+		Sku:      "S0",
+	})
+	server.AddMetricDefinitions("Microsoft.Compute/virtualMachines",
+		azuretest.MetricDefinition{Name: "Percentage CPU", Unit: "Percent", PrimaryAggregation: "Average"},
+		azuretest.MetricDefinition{Name: "Network In", Unit: "Bytes", PrimaryAggregation: "Total"},
+	)
+	server.AddMetricDefinitions("Microsoft.Sql/servers/databases",
+		azuretest.MetricDefinition{Name: "dtu_consumption_percent", Unit: "Percent", PrimaryAggregation: "Average"},
+	)
+	server.SetMetric(testVM, azuretest.Metric{Name: "Percentage CPU", Unit: "Percent", Timeseries: []azuretest.Timeseries{
+		{Data: []azuretest.DataPoint{{"average": 12.5, "minimum": 3, "maximum": 40, "total": 25}}},
+	}})
+	server.SetMetric(testVM, azuretest.Metric{Name: "Network In", Unit: "Bytes", Timeseries: []azuretest.Timeseries{
+		{Data: []azuretest.DataPoint{{"total": 1024}}},
+	}})
+	server.SetMetric(testDB, azuretest.Metric{Name: "dtu_consumption_percent", Unit: "Percent", Timeseries: []azuretest.Timeseries{
+		{Data: []azuretest.DataPoint{{"average": 80, "maximum": 95}}},
+	}})
+
+	return server, c, NewAzureClient(c.Credentials, server.Client())
+}
+
+const testCredentials = `
+credentials:
+  subscription_id: ` + testSubscription + `
+  tenant_id: ` + testTenant + `
+  client_id: ` + testClient + `
+  client_secret: secret
+`
+
+// gather collects c and returns the gathered samples by metric name.
+func gather(t *testing.T, c prometheus.Collector) map[string][]*dto.Metric {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Error gathering metrics: %v", err)
+	}
+
+	result := make(map[string][]*dto.Metric)
+	for _, family := range families {
+		result[family.GetName()] = family.GetMetric()
+	}
+	return result
+}
+
+func labelMap(m *dto.Metric) map[string]string {
+	labels := make(map[string]string)
+	for _, pair := range m.GetLabel() {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	return labels
+}
+
+func TestCollectResources(t *testing.T) {
+	_, cfg, client := setupTest(t, testCredentials+`
+tag_labels:
+  team: owner_team
+resources:
+  - name: /resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-1
+    metrics:
+      - Percentage CPU
+      - Network In
+    aggregations:
+      - Average
+      - Maximum
+`)
+
+	metrics := gather(t, NewCollector(cfg, client))
+
+	for name, want := range map[string]float64{
+		"percentage_cpu_percent_average": 12.5,
+		"percentage_cpu_percent_max":     40,
+	} {
+		got := metrics[name]
+		if len(got) != 1 {
+			t.Errorf("Expected one sample of %s, got %d", name, len(got))
+			continue
+		}
+		if v := got[0].GetGauge().GetValue(); v != want {
+			t.Errorf("Expected %s to be %v, got %v", name, want, v)
+		}
+	}
+	if _, ok := metrics["percentage_cpu_percent_min"]; ok {
+		t.Errorf("Expected no minimum aggregation to be collected")
+	}
+
+	labels := labelMap(metrics["percentage_cpu_percent_average"][0])
+	for k, want := range map[string]string{
+		"resource_id":     testVM,
+		"subscription_id": testSubscription,
+		"resource_group":  "web",
+		"resource_type":   "Microsoft.Compute/virtualMachines",
+		"resource_name":   "web-1",
+		"owner_team":      "web",
+	} {
+		if labels[k] != want {
+			t.Errorf("Expected label %s=%q, got %q", k, want, labels[k])
+		}
+	}
+
+	info := metrics["azure_resource_info"]
+	if len(info) != 1 {
+		t.Fatalf("Expected one azure_resource_info sample, got %d", len(info))
+	}
+	labels = labelMap(info[0])
+	if labels["location"] != "westeurope" || labels["sku"] != "Standard_B2s" {
+		t.Errorf("Unexpected resource info labels %v", labels)
+	}
+}
+
+func TestCollectResourceGroups(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+resource_groups:
+  - name: "*"
+    resource_types:
+      - Microsoft.Sql/servers/databases
+    metrics:
+      - dtu_consumption_percent
+`)
+
+	metrics := gather(t, NewCollector(cfg, client))
+
+	got := metrics["dtu_consumption_percent_percent_max"]
+	if len(got) != 1 || got[0].GetGauge().GetValue() != 95 {
+		t.Fatalf("Unexpected dtu_consumption_percent_percent_max samples %v", got)
+	}
+	labels := labelMap(got[0])
+	if labels["resource_name"] != "orders" || labels["resource_type"] != "Microsoft.Sql/servers/databases" {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+	if _, ok := metrics["percentage_cpu_percent_average"]; ok {
+		t.Errorf("Expected resources of other types not to be collected")
+	}
+
+	if n := server.CountRequests("Microsoft.Compute"); n != 0 {
+		t.Errorf("Expected no requests for virtual machines, got %d", n)
+	}
+	if n := server.TokenRequests(); n != 1 {
+		t.Errorf("Expected the access token to be requested once, got %d", n)
+	}
+}
+
+func TestCollectSeveralConfigs(t *testing.T) {
+	_, web, client := setupTest(t, testCredentials+`
+resources:
+  - name: /resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-1
+    metrics:
+      - Percentage CPU
+`)
+	data := &config.Config{
+		Credentials: web.Credentials,
+		Resources: []config.Resource{{
+			Name:    "/resourceGroups/data/providers/Microsoft.Sql/servers/sql-1/databases/orders",
+			Metrics: config.MetricList{"dtu_consumption_percent"},
+		}},
+	}
+	if err := data.Compile(); err != nil {
+		t.Fatalf("Error compiling config: %v", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(NewCollector(web, client)); err != nil {
+		t.Fatalf("Error registering collector: %v", err)
+	}
+	if err := registry.Register(NewCollector(data, client)); err != nil {
+		t.Fatalf("Error registering second collector: %v", err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Error gathering metrics: %v", err)
+	}
+
+	names := make(map[string]bool)
+	for _, family := range families {
+		names[family.GetName()] = true
+	}
+	for _, name := range []string{"percentage_cpu_percent_average", "dtu_consumption_percent_percent_average"} {
+		if !names[name] {
+			t.Errorf("Expected %s to be collected, got %v", name, names)
+		}
+	}
+}
+
+// failingGroupAPI fails to list the resources of the resource group data.
+type failingGroupAPI struct {
+	ResourceListAPI
+}
+
+func (a failingGroupAPI) ListFromResourceGroup(group string, resourceTypes []string) ([]AzureResource, error) {
+	if group == "data" {
+		return nil, fmt.Errorf("Unable to query resource list API: Unexpected status code: 404")
+	}
+	return a.ResourceListAPI.ListFromResourceGroup(group, resourceTypes)
+}
+
+func TestListResourceGroupTargets(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+resource_groups:
+  - name: "*"
+    resource_types:
+      - Microsoft.Compute/virtualMachines
+    metrics:
+      - Percentage CPU
+  - name: "[a-z]*"
+    resource_types:
+      - Microsoft.Compute/virtualMachines
+      - Microsoft.Sql/servers/databases
+    metrics:
+      - Percentage CPU
+`)
+	server.AddResource(azuretest.Resource{ID: strings.Replace(testVM, "web-1", "web-2", 1), Location: "westeurope"})
+	server.AddResource(azuretest.Resource{ID: strings.Replace(testVM, "/web/", "/api/", 1), Location: "westeurope"})
+	server.SetPageSize(1)
+
+	found, err := ListResourceGroupTargets(client, cfg.ResourceGroups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 3 {
+		t.Errorf("Expected the virtual machines of all pages, got %v", found)
+	}
+
+	found, err = ListResourceGroupTargets(failingGroupAPI{client}, cfg.ResourceGroups[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range found {
+		names = append(names, r.Name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "web-1,web-1,web-2" {
+		t.Errorf("Expected the resources of the groups api and web, got %v", names)
+	}
+}
+
+func TestCollectPartialResponses(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+resources:
+  - name: /resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-1
+    metrics:
+      - Percentage CPU
+      - Disk Read Bytes
+      - Available Memory Bytes
+      - Inbound Flows
+    aggregations:
+      - Average
+`)
+	server.SetMetric(testVM, azuretest.Metric{Name: "Disk Read Bytes", Unit: "Bytes"})
+	server.SetMetric(testVM, azuretest.Metric{Name: "Available Memory Bytes", Unit: "Bytes", Timeseries: []azuretest.Timeseries{
+		{Data: []azuretest.DataPoint{{"maximum": 1024}}},
+	}})
+	server.SetMetric(testVM, azuretest.Metric{Name: "Inbound Flows", Unit: "Count", Timeseries: []azuretest.Timeseries{
+		{Metadata: map[string]string{"Direction": "in"}, Data: []azuretest.DataPoint{{"average": 5}}},
+		{Metadata: map[string]string{"Direction": "out"}, Data: []azuretest.DataPoint{}},
+	}})
+
+	metrics := gather(t, NewCollector(cfg, client))
+
+	if got := metrics["percentage_cpu_percent_average"]; len(got) != 1 || got[0].GetGauge().GetValue() != 12.5 {
+		t.Errorf("Unexpected percentage_cpu_percent_average samples %v", got)
+	}
+	if _, ok := metrics["available_memory_bytes_bytes_average"]; ok {
+		t.Errorf("Expected absent average not to be exported as zero")
+	}
+
+	flows := metrics["inbound_flows_count_average"]
+	if len(flows) != 1 || flows[0].GetGauge().GetValue() != 5 {
+		t.Fatalf("Unexpected inbound_flows_count_average samples %v", flows)
+	}
+	if labels := labelMap(flows[0]); labels["dimension_direction"] != "in" {
+		t.Errorf("Expected dimension label, got %v", labels)
+	}
+
+	var missing []string
+	for _, m := range metrics["azure_metric_missing"] {
+		labels := labelMap(m)
+		if labels["resource_name"] != "web-1" {
+			t.Errorf("Unexpected labels %v", labels)
+		}
+		missing = append(missing, labels["metric"])
+	}
+	sort.Strings(missing)
+	if strings.Join(missing, ",") != "Available Memory Bytes,Disk Read Bytes" {
+		t.Errorf("Unexpected missing metrics %v", missing)
+	}
+}
+
+func TestCollectNullPolicies(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+resources:
+  - name: /resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-1
+    metrics:
+      - Percentage CPU
+      - Network In
+      - Network Out
+    aggregations:
+      - Average
+    null_policy: skip
+    metric_null_policies:
+      percentage cpu: last
+      Network Out: nan
+`)
+	for _, name := range []string{"Percentage CPU", "Network In", "Network Out"} {
+		server.SetMetric(testVM, azuretest.Metric{Name: name, Unit: "Percent", Timeseries: []azuretest.Timeseries{
+			{Data: []azuretest.DataPoint{{"average": 7}, {}}},
+		}})
+	}
+
+	metrics := gather(t, NewCollector(cfg, client))
+
+	if got := metrics["percentage_cpu_percent_average"]; len(got) != 1 || got[0].GetGauge().GetValue() != 7 {
+		t.Errorf("Expected the last non-null value, got %v", got)
+	}
+	if got := metrics["network_in_percent_average"]; len(got) != 0 {
+		t.Errorf("Expected no value to be exported, got %v", got)
+	}
+	if got := metrics["network_out_percent_average"]; len(got) != 1 || !math.IsNaN(got[0].GetGauge().GetValue()) {
+		t.Errorf("Expected NaN to be exported, got %v", got)
+	}
+	if got := len(metrics["azure_metric_missing"]); got != 2 {
+		t.Errorf("Expected 2 missing metrics, got %d", got)
+	}
+}
+
+func TestCollectNullPolicyLastWindow(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+resources:
+  - name: /resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-1
+    metrics:
+      - Percentage CPU
+    aggregations:
+      - Average
+    null_policy: skip
+  - name: /resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-2
+    metrics:
+      - Percentage CPU
+    aggregations:
+      - Average
+`)
+	web2 := strings.Replace(testVM, "web-1", "web-2", 1)
+	server.AddResource(azuretest.Resource{ID: web2, Location: "westeurope"})
+	// Only the oldest of several time grains has a value.
+	data := []azuretest.DataPoint{{"average": 7}, {}, {}, {}, {}}
+	server.SetMetric(testVM, azuretest.Metric{Name: "Percentage CPU", Unit: "Percent", Timeseries: []azuretest.Timeseries{{Data: data}}})
+	server.SetMetric(web2, azuretest.Metric{Name: "Percentage CPU", Unit: "Percent", Timeseries: []azuretest.Timeseries{{Data: data}}})
+
+	metrics := gather(t, NewCollector(cfg, client))
+
+	got := metrics["percentage_cpu_percent_average"]
+	if len(got) != 1 || labelMap(got[0])["resource_name"] != "web-2" || got[0].GetGauge().GetValue() != 7 {
+		t.Errorf("Expected the last non-null value of web-2 only, got %v", got)
+	}
+	if got := metrics["azure_metric_missing"]; len(got) != 1 || labelMap(got[0])["resource_name"] != "web-1" {
+		t.Errorf("Expected web-1 to miss its metric, got %v", got)
+	}
+
+	for _, r := range server.Requests() {
+		if !strings.Contains(r, "/providers/microsoft.insights/metrics?") {
+			continue
+		}
+		u, err := url.Parse(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.Split(u.Query().Get("timespan"), "/")
+		from, _ := time.Parse(time.RFC3339, parts[0])
+		to, _ := time.Parse(time.RFC3339, parts[len(parts)-1])
+		want := time.Minute
+		if strings.Contains(r, "web-2") {
+			want = NullPolicyLastGrains * time.Minute
+		}
+		if to.Sub(from) != want || u.Query().Get("interval") != "PT1M" {
+			t.Errorf("Expected a window of %v with an interval of PT1M, got %s", want, r)
+		}
+	}
+}
+
+func TestCollectTimeGrains(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+resources:
+  - name: /resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-1
+    metrics:
+      - Percentage CPU
+      - Available Memory Bytes
+    aggregations:
+      - Average
+resource_groups:
+  - name: data
+    resource_types:
+      - Microsoft.Sql/servers/databases
+    metrics: all
+    null_policy: skip
+`)
+	server.AddMetricDefinitions("Microsoft.Compute/virtualMachines",
+		azuretest.MetricDefinition{Name: "Available Memory Bytes", Unit: "Bytes", PrimaryAggregation: "Average", TimeGrains: []string{"PT1H", "PT5M"}},
+	)
+	server.AddMetricDefinitions("Microsoft.Sql/servers/databases",
+		azuretest.MetricDefinition{Name: "storage", Unit: "Bytes", PrimaryAggregation: "Maximum", TimeGrains: []string{"PT1H"}},
+	)
+	server.SetMetric(testVM, azuretest.Metric{Name: "Available Memory Bytes", Unit: "Bytes", Timeseries: []azuretest.Timeseries{
+		{Data: []azuretest.DataPoint{{"average": 1024}}},
+	}})
+	server.SetMetric(testDB, azuretest.Metric{Name: "storage", Unit: "Bytes", Timeseries: []azuretest.Timeseries{
+		{Data: []azuretest.DataPoint{{"maximum": 2048}}},
+	}})
+
+	metrics := gather(t, NewCollector(cfg, client))
+
+	for name, want := range map[string]float64{
+		"percentage_cpu_percent_average":       12.5,
+		"available_memory_bytes_bytes_average": 1024,
+		"storage_bytes_max":                    2048,
+	} {
+		if got := metrics[name]; len(got) != 1 || got[0].GetGauge().GetValue() != want {
+			t.Errorf("Expected %s to be %v, got %v", name, want, got)
+		}
+	}
+
+	// Metrics are queried in the smallest time grain they are available in.
+	want := map[string]string{
+		"Percentage CPU":          "PT1M",
+		"Available Memory Bytes":  "PT5M",
+		"dtu_consumption_percent": "PT1M",
+		"storage":                 "PT1H",
+	}
+	for _, r := range server.Requests() {
+		if !strings.Contains(r, "/providers/microsoft.insights/metrics?") {
+			continue
+		}
+		u, err := url.Parse(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range strings.Split(u.Query().Get("metricnames"), ",") {
+			if interval := u.Query().Get("interval"); interval != want[name] {
+				t.Errorf("Expected %s to be queried per %s, got %s", name, want[name], interval)
+			}
+			delete(want, name)
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("Expected metrics %v to be queried", want)
+	}
+}
+
+func TestCollectResourceHealth(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+resources:
+  - name: /resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-1
+    metrics:
+      - Percentage CPU
+    resource_health: true
+resource_groups:
+  - name: "*"
+    resource_types:
+      - Microsoft.Compute/virtualMachines
+      - Microsoft.Sql/servers/databases
+    metrics:
+      - Percentage CPU
+    resource_health: true
+    resource_include:
+      - orders
+`)
+	server.SetAvailabilityStatus(testVM, azuretest.AvailabilityStatus{State: "Unavailable", ReasonType: "Unplanned"})
+	server.SetAvailabilityStatus(testDB, azuretest.AvailabilityStatus{State: "Available"})
+
+	metrics := gather(t, NewCollector(cfg, client))
+
+	health := make(map[string]*dto.Metric)
+	for _, m := range metrics["azure_resource_health_available"] {
+		health[labelMap(m)["resource_name"]] = m
+	}
+	if len(health) != 2 {
+		t.Fatalf("Expected the health of 2 resources, got %v", metrics["azure_resource_health_available"])
+	}
+	if labels := labelMap(health["web-1"]); health["web-1"].GetGauge().GetValue() != 0 || labels["availability_state"] != "Unavailable" || labels["reason_type"] != "Unplanned" {
+		t.Errorf("Unexpected health of web-1: %v", health["web-1"])
+	}
+	if health["orders"].GetGauge().GetValue() != 1 {
+		t.Errorf("Unexpected health of orders: %v", health["orders"])
+	}
+}
+
+func TestCollectMetricNamespace(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+resources:
+  - name: /resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-1
+    namespace: azure.vm.linux.guestmetrics
+    metrics: all
+    aggregations:
+      - Average
+`)
+	server.AddMetricDefinitions("Microsoft.Compute/virtualMachines",
+		azuretest.MetricDefinition{Namespace: "azure.vm.linux.guestmetrics", Name: "mem/available_percent", Unit: "Percent", PrimaryAggregation: "Average"},
+	)
+	server.SetMetric(testVM, azuretest.Metric{Namespace: "azure.vm.linux.guestmetrics", Name: "mem/available_percent", Unit: "Percent", Timeseries: []azuretest.Timeseries{
+		{Data: []azuretest.DataPoint{{"average": 64}}},
+	}})
+
+	metrics := gather(t, NewCollector(cfg, client))
+
+	got := metrics["mem_per_available_percent_percent_average"]
+	if len(got) != 1 || got[0].GetGauge().GetValue() != 64 {
+		t.Errorf("Unexpected guest memory metric: %v", got)
+	}
+	if _, ok := metrics["percentage_cpu_percent_average"]; ok {
+		t.Errorf("Expected only metrics of the guest namespace to be collected")
+	}
+
+	namespaces, err := client.GetMetricNamespaces(&ResourceID{ID: testVM, ResourceType: "Microsoft.Compute/virtualMachines"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(namespaces.Value) != 2 || namespaces.Value[1].Properties.MetricNamespaceName != "azure.vm.linux.guestmetrics" {
+		t.Errorf("Unexpected metric namespaces: %+v", namespaces.Value)
+	}
+
+	// Guest and custom metrics may differ between resources of a type.
+	web2 := &ResourceID{ID: strings.Replace(testVM, "web-1", "web-2", 1), ResourceType: "Microsoft.Compute/virtualMachines"}
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetMetricDefinitions(web2, "azure.vm.linux.guestmetrics"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if queries := server.CountRequests("/metricDefinitions?"); queries != 2 {
+		t.Errorf("Expected the definitions of the namespace to be cached per resource, got %d queries", queries)
+	}
+}
+
+func TestCollectFailedRequest(t *testing.T) {
+	_, cfg, client := setupTest(t, testCredentials+`
+resources:
+  - name: /resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-1
+    metrics:
+      - Percentage CPU
+      - Unknown Metric
+`)
+
+	metrics := gather(t, NewCollector(cfg, client))
+
+	if got := len(metrics["azure_metric_missing"]); got != 2 {
+		t.Errorf("Expected all metrics of a failed request to be missing, got %d", got)
+	}
+	if got := len(metrics["azure_resource_info"]); got != 1 {
+		t.Errorf("Expected azure_resource_info to be exported, got %d", got)
+	}
+}
+
+// staticAPI answers metric value requests with a fixed response. Other requests are not implemented.
+type staticAPI struct {
+	values AzureMetricValueResponse
+}
+
+func (a *staticAPI) GetResource(*ResourceID) (AzureResource, error) {
+	return AzureResource{}, fmt.Errorf("not implemented")
+}
+
+func (a *staticAPI) GetMetricNamespaces(*ResourceID) (AzureMetricNamespaceResponse, error) {
+	return AzureMetricNamespaceResponse{}, fmt.Errorf("not implemented")
+}
+
+func (a *staticAPI) GetMetricDefinitions(*ResourceID, string) (AzureMetricDefinitionResponse, error) {
+	return AzureMetricDefinitionResponse{}, fmt.Errorf("not implemented")
+}
+
+func (a *staticAPI) GetMetricValues(string, string, string, []string, time.Duration, time.Duration) (AzureMetricValueResponse, error) {
+	return a.values, nil
+}
+
+func TestProbeCollector(t *testing.T) {
+	api := &staticAPI{}
+	if err := json.Unmarshal([]byte(`{"value": [{
+		"name": {"value": "Http5xx"},
+		"unit": "Count",
+		"timeseries": [{"data": [{"timeStamp": "2018-01-01T00:00:00Z", "total": 7}]}]
+	}]}`), &api.values); err != nil {
+		t.Fatal(err)
+	}
+
+	site := "/subscriptions/sub/resourceGroups/web/providers/Microsoft.Web/sites/blog"
+	metrics := gather(t, NewProbeCollector(&config.Config{}, api, site, config.Module{Metrics: []string{"Http5xx"}, Aggregations: []string{"Total"}}))
+
+	got := metrics["http5xx_count_total"]
+	if len(got) != 1 || got[0].GetGauge().GetValue() != 7 {
+		t.Fatalf("Unexpected http5xx_count_total samples %v", got)
+	}
+	if labels := labelMap(got[0]); labels["resource_name"] != "blog" {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+	// The resource metadata could not be looked up, but the info metric is still exported.
+	if len(metrics["azure_resource_info"]) != 1 {
+		t.Errorf("Expected an azure_resource_info sample")
+	}
+}
@@ -0,0 +1,261 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/credativ/azure_metrics_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AzureCostQuery represents the body of a Cost Management query.
+type AzureCostQuery struct {
+	Type       string               `json:"type"`
+	Timeframe  string               `json:"timeframe"`
+	TimePeriod *AzureCostTimePeriod `json:"timePeriod,omitempty"`
+	Dataset    AzureCostDataset     `json:"dataset"`
+}
+
+// AzureCostTimePeriod is the period of a query with a custom timeframe.
+type AzureCostTimePeriod struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// AzureCostDataset describes how costs are aggregated and grouped by a query.
+type AzureCostDataset struct {
+	Granularity string                          `json:"granularity"`
+	Aggregation map[string]AzureCostAggregation `json:"aggregation"`
+	Grouping    []AzureCostGrouping             `json:"grouping,omitempty"`
+}
+
+// AzureCostAggregation is a column aggregated by a query.
+type AzureCostAggregation struct {
+	Name     string `json:"name"`
+	Function string `json:"function"`
+}
+
+// AzureCostGrouping is a dimension or tag costs are grouped by.
+type AzureCostGrouping struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// AzureCostQueryResponse represents the result of a Cost Management query.
+type AzureCostQueryResponse struct {
+	Properties struct {
+		NextLink string `json:"nextLink"`
+		Columns  []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"columns"`
+		Rows [][]interface{} `json:"rows"`
+	} `json:"properties"`
+}
+
+// How long collecting waits for the first result of a cost query, which may take a while
+// if the Cost Management API throttles requests.
+const costQueryWait = 10 * time.Second
+
+// QueryCost runs a Cost Management query for a scope, e.g. /subscriptions/<id>. As the
+// API is heavily throttled and slow, results are reused until they are maxAge old and
+// refreshed in the background. If a refresh fails, the previous result is used as long
+// as there is one.
+func (ac *AzureClient) QueryCost(scope string, query AzureCostQuery, maxAge time.Duration) (AzureCostQueryResponse, error) {
+	keyData, err := json.Marshal(query)
+	if err != nil {
+		return AzureCostQueryResponse{}, fmt.Errorf("Error marshalling query: %v", err)
+	}
+	key := "costs of " + strings.ToLower(scope) + " " + string(keyData)
+
+	value, err := ac.cachedInBackground(key, maxAge, costQueryWait, func() (interface{}, error) {
+		return ac.queryCost(scope, query)
+	})
+	if err != nil {
+		return AzureCostQueryResponse{}, err
+	}
+	return value.(AzureCostQueryResponse), nil
+}
+
+// queryCost runs a Cost Management query, following all result pages.
+func (ac *AzureClient) queryCost(scope string, query AzureCostQuery) (AzureCostQueryResponse, error) {
+	apiVersion := "2019-11-01"
+	endpoint := fmt.Sprintf("https://management.azure.com%s/providers/Microsoft.CostManagement/query?api-version=%s", scope, apiVersion)
+
+	var result AzureCostQueryResponse
+	for endpoint != "" {
+		body, err := ac.postJSON(managementResource, endpoint, query)
+		if err != nil {
+			return AzureCostQueryResponse{}, fmt.Errorf("Unable to query cost management API: %v", err)
+		}
+
+		var page AzureCostQueryResponse
+		err = json.Unmarshal(body, &page)
+		if err != nil {
+			return AzureCostQueryResponse{}, fmt.Errorf("Error unmarshalling response body: %v", err)
+		}
+		if result.Properties.Columns == nil {
+			result.Properties.Columns = page.Properties.Columns
+		}
+		result.Properties.Rows = append(result.Properties.Rows, page.Properties.Rows...)
+		endpoint = page.Properties.NextLink
+	}
+
+	return result, nil
+}
+
+// NewCostQuery returns the query for costs of the given type as configured by cost.
+// Costs for the configured timeframe are summed up, Today and Yesterday are relative to now in UTC.
+func NewCostQuery(costType string, cost config.Cost, now time.Time) AzureCostQuery {
+	query := AzureCostQuery{
+		Type:      costType,
+		Timeframe: cost.Timeframe,
+	}
+	query.Dataset.Granularity = "None"
+	query.Dataset.Aggregation = map[string]AzureCostAggregation{
+		"totalCost": {Name: "Cost", Function: "Sum"},
+	}
+
+	switch cost.Timeframe {
+	case "Today", "Yesterday":
+		day := now.UTC().Truncate(24 * time.Hour)
+		if cost.Timeframe == "Yesterday" {
+			day = day.Add(-24 * time.Hour)
+		}
+		query.Timeframe = "Custom"
+		query.TimePeriod = &AzureCostTimePeriod{
+			From: day.Format(time.RFC3339),
+			To:   day.Add(24*time.Hour - time.Second).Format(time.RFC3339),
+		}
+	}
+
+	for _, g := range cost.GroupBy {
+		if g.Tag != "" {
+			query.Dataset.Grouping = append(query.Dataset.Grouping, AzureCostGrouping{Type: "TagKey", Name: g.Tag})
+		} else {
+			query.Dataset.Grouping = append(query.Dataset.Grouping, AzureCostGrouping{Type: "Dimension", Name: g.Dimension})
+		}
+	}
+
+	return query
+}
+
+// costColumnNames are the possible names of the column holding the summed up costs.
+var costColumnNames = []string{"cost", "totalcost", "pretaxcost", "costusd"}
+
+// collectCosts exports the results of the configured Cost Management queries.
+func (c *Collector) collectCosts(ch chan<- prometheus.Metric) {
+	// All cost metrics need the same label names, so each one carries the labels of all groupings.
+	var groupLabels []string
+	seen := make(map[string]bool)
+	for _, cost := range c.config.Costs {
+		for _, g := range cost.GroupBy {
+			if name := g.LabelName(); !seen[name] {
+				seen[name] = true
+				groupLabels = append(groupLabels, name)
+			}
+		}
+	}
+
+	// Overlapping entries may return the same costs, but samples must be unique, so only
+	// the first one of each label combination is exported.
+	collected := make(map[string]bool)
+	subscriptionID := c.config.Credentials.SubscriptionID
+	for _, cost := range c.config.Costs {
+		scope := "/subscriptions/" + subscriptionID
+		if cost.ResourceGroup != "" {
+			scope += "/resourceGroups/" + cost.ResourceGroup
+		}
+
+		for _, costType := range cost.Types {
+			result, err := c.client.QueryCost(scope, NewCostQuery(costType, cost, time.Now()), cost.Interval)
+			if err != nil {
+				log.Printf("Failed to query %s of %s: %v", costType, scope, err)
+				continue
+			}
+
+			columns := make(map[string]int)
+			for i, column := range result.Properties.Columns {
+				columns[strings.ToLower(column.Name)] = i
+			}
+			costColumn := -1
+			for _, name := range costColumnNames {
+				if i, ok := columns[name]; ok {
+					costColumn = i
+					break
+				}
+			}
+			if costColumn < 0 {
+				log.Printf("No cost column in %s result of %s", costType, scope)
+				continue
+			}
+			cell := func(row []interface{}, column string) string {
+				i, ok := columns[column]
+				if !ok || i >= len(row) || row[i] == nil {
+					return ""
+				}
+				return fmt.Sprint(row[i])
+			}
+
+			for _, row := range result.Properties.Rows {
+				if len(row) < len(result.Properties.Columns) {
+					log.Printf("Skipping %s row of %s with %d of %d columns: %v", costType, scope, len(row), len(result.Properties.Columns), row)
+					continue
+				}
+				value, ok := row[costColumn].(float64)
+				if !ok {
+					continue
+				}
+
+				labels := map[string]string{
+					"subscription_id": subscriptionID,
+					"scope":           scope,
+					"type":            costType,
+					"timeframe":       cost.Timeframe,
+					"currency":        cell(row, "currency"),
+				}
+				for _, name := range groupLabels {
+					labels[name] = ""
+				}
+				for _, g := range cost.GroupBy {
+					if g.Tag != "" {
+						labels[g.LabelName()] = cell(row, "tagvalue")
+					} else {
+						labels[g.LabelName()] = cell(row, strings.ToLower(g.Dimension))
+					}
+				}
+
+				key := costLabelKey(labels)
+				if collected[key] {
+					log.Printf("Skipping %s of %s with duplicate labels %v", costType, scope, labels)
+					continue
+				}
+				collected[key] = true
+
+				ch <- prometheus.MustNewConstMetric(
+					prometheus.NewDesc("azure_cost", "Costs summed up for the timeframe as reported by Azure Cost Management.", nil, labels),
+					prometheus.GaugeValue,
+					value,
+				)
+			}
+		}
+	}
+}
+
+// costLabelKey returns a key identifying the sample with the given labels.
+func costLabelKey(labels map[string]string) string {
+	var names []string
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var key []string
+	for _, name := range names {
+		key = append(key, name+"="+labels[name])
+	}
+	return strings.Join(key, "\xff")
+}
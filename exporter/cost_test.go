@@ -0,0 +1,190 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/credativ/azure_metrics_exporter/azuretest"
+	"github.com/credativ/azure_metrics_exporter/config"
+)
+
+func TestCollectCosts(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+costs:
+  - types:
+      - ActualCost
+    group_by:
+      - dimension: ServiceName
+  - resource_group: web
+    types:
+      - AmortizedCost
+    group_by:
+      - tag: Team
+`)
+	server.SetCosts("/subscriptions/"+testSubscription, "ActualCost", azuretest.CostResult{
+		Columns: []string{"Cost", "ServiceName", "Currency"},
+		Rows: [][]interface{}{
+			{12.5, "Virtual Machines", "EUR"},
+			{3.0, "Storage", "EUR"},
+		},
+	})
+	server.SetCosts("/subscriptions/"+testSubscription+"/resourceGroups/web", "AmortizedCost", azuretest.CostResult{
+		Columns: []string{"Cost", "TagKey", "TagValue", "Currency"},
+		Rows: [][]interface{}{
+			{7.0, "team", "web", "EUR"},
+		},
+	})
+
+	metrics := gather(t, NewCollector(cfg, client))
+
+	costs := make(map[string]map[string]string)
+	values := make(map[string]float64)
+	for _, m := range metrics["azure_cost"] {
+		labels := labelMap(m)
+		key := labels["type"] + "/" + labels["service_name"] + "/" + labels["tag_team"]
+		costs[key] = labels
+		values[key] = m.GetGauge().GetValue()
+	}
+	if len(costs) != 3 {
+		t.Fatalf("Expected 3 costs, got %v", metrics["azure_cost"])
+	}
+
+	vm := costs["ActualCost/Virtual Machines/"]
+	if values["ActualCost/Virtual Machines/"] != 12.5 || vm["currency"] != "EUR" || vm["timeframe"] != "MonthToDate" || vm["scope"] != "/subscriptions/"+testSubscription {
+		t.Errorf("Unexpected cost of virtual machines: %v %v", vm, values["ActualCost/Virtual Machines/"])
+	}
+	web := costs["AmortizedCost//web"]
+	if values["AmortizedCost//web"] != 7 || web["scope"] != "/subscriptions/"+testSubscription+"/resourceGroups/web" {
+		t.Errorf("Unexpected cost of team web: %v %v", web, values["AmortizedCost//web"])
+	}
+}
+
+func TestCollectCostsCached(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+costs:
+  - types:
+      - ActualCost
+`)
+	server.SetCosts("/subscriptions/"+testSubscription, "ActualCost", azuretest.CostResult{
+		Columns: []string{"Cost", "Currency"},
+		Rows:    [][]interface{}{{42.0, "USD"}},
+	})
+
+	for i := 0; i < 2; i++ {
+		metrics := gather(t, NewCollector(cfg, client))
+		if len(metrics["azure_cost"]) != 1 || metrics["azure_cost"][0].GetGauge().GetValue() != 42 {
+			t.Fatalf("Unexpected costs: %v", metrics["azure_cost"])
+		}
+	}
+
+	if queries := server.CountRequests("/providers/Microsoft.CostManagement/query"); queries != 1 {
+		t.Errorf("Expected costs to be queried once, got %d queries", queries)
+	}
+}
+
+func TestNewCostQuery(t *testing.T) {
+	now := time.Date(2020, 3, 1, 10, 30, 0, 0, time.UTC)
+
+	query := NewCostQuery("ActualCost", config.Cost{Timeframe: "Yesterday", GroupBy: []config.CostGrouping{{Tag: "Team"}}}, now)
+	if query.Timeframe != "Custom" || query.TimePeriod == nil {
+		t.Fatalf("Expected a custom timeframe, got %+v", query)
+	}
+	if query.TimePeriod.From != "2020-02-29T00:00:00Z" || query.TimePeriod.To != "2020-02-29T23:59:59Z" {
+		t.Errorf("Unexpected time period: %+v", query.TimePeriod)
+	}
+	if len(query.Dataset.Grouping) != 1 || query.Dataset.Grouping[0] != (AzureCostGrouping{Type: "TagKey", Name: "Team"}) {
+		t.Errorf("Unexpected grouping: %+v", query.Dataset.Grouping)
+	}
+
+	query = NewCostQuery("AmortizedCost", config.Cost{Timeframe: "MonthToDate"}, now)
+	if query.Timeframe != "MonthToDate" || query.TimePeriod != nil || query.Type != "AmortizedCost" {
+		t.Errorf("Unexpected query: %+v", query)
+	}
+}
+
+func TestCollectMalformedCosts(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+costs:
+  - types:
+      - ActualCost
+    group_by:
+      - dimension: ServiceName
+`)
+	server.SetCosts("/subscriptions/"+testSubscription, "ActualCost", azuretest.CostResult{
+		Columns: []string{"ServiceName", "Currency", "Cost"},
+		Rows: [][]interface{}{
+			{"Storage", "EUR"},
+			{},
+			{"Virtual Machines", "EUR", 12.5},
+		},
+	})
+
+	metrics := gather(t, NewCollector(cfg, client))
+
+	got := metrics["azure_cost"]
+	if len(got) != 1 || labelMap(got[0])["service_name"] != "Virtual Machines" {
+		t.Errorf("Expected only the complete row to be exported, got %v", got)
+	}
+}
+
+func TestCollectOverlappingCosts(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+costs:
+  - types:
+      - ActualCost
+  - types:
+      - ActualCost
+      - AmortizedCost
+`)
+	for _, costType := range []string{"ActualCost", "AmortizedCost"} {
+		server.SetCosts("/subscriptions/"+testSubscription, costType, azuretest.CostResult{
+			Columns: []string{"Cost", "Currency"},
+			Rows:    [][]interface{}{{42.0, "USD"}},
+		})
+	}
+
+	metrics := gather(t, NewCollector(cfg, client))
+
+	if len(metrics["azure_cost"]) != 2 {
+		t.Errorf("Expected each cost to be exported once, got %v", metrics["azure_cost"])
+	}
+}
+
+func TestCachedInBackground(t *testing.T) {
+	ac := NewAzureClient(config.Credentials{}, nil)
+	fetched := make(chan string, 1)
+	fetch := func() (interface{}, error) {
+		return <-fetched, nil
+	}
+
+	// Without a result, callers wait for the first fetch.
+	fetched <- "first"
+	if v, err := ac.cachedInBackground("key", 0, time.Second, fetch); err != nil || v != "first" {
+		t.Fatalf("Expected the first result, got %v, %v", v, err)
+	}
+
+	// Later on, the previous result is returned while refreshing.
+	if v, err := ac.cachedInBackground("key", 0, time.Second, fetch); err != nil || v != "first" {
+		t.Fatalf("Expected the previous result while refreshing, got %v, %v", v, err)
+	}
+	fetched <- "second"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		v, err := ac.cachedInBackground("key", time.Hour, time.Second, fetch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v == "second" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the result to be refreshed in the background, got %v", v)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := ac.cachedInBackground("other", 0, 10*time.Millisecond, fetch); err == nil {
+		t.Errorf("Expected an error while the first fetch is still running")
+	}
+	fetched <- "other"
+}
@@ -0,0 +1,85 @@
+package exporter
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/credativ/azure_metrics_exporter/config"
+)
+
+var invalidLabelChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// TargetGroup represents a target group of the Prometheus HTTP service discovery format.
+type TargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// discoveryLabels returns the __meta_azure_* labels describing a resource.
+func discoveryLabels(resource AzureResource) (map[string]string, error) {
+	resourceID, err := ParseResourceID(resource.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{
+		"__meta_azure_resource_id":     resourceID.ID,
+		"__meta_azure_subscription_id": resourceID.SubscriptionID,
+		"__meta_azure_resource_group":  resourceID.ResourceGroup,
+		"__meta_azure_resource_type":   resourceID.ResourceType,
+		"__meta_azure_resource_name":   resourceID.Name,
+		"__meta_azure_location":        resource.Location,
+		"__meta_azure_kind":            resource.Kind,
+		"__meta_azure_sku":             resource.Sku.Name,
+	}
+	for k, v := range resource.Tags {
+		labels["__meta_azure_tag_"+invalidLabelChars.ReplaceAllString(k, "_")] = v
+	}
+
+	return labels, nil
+}
+
+// DiscoverTargets returns a target group for every resource selected by the configuration.
+// If any resource can't be looked up or listed, an error is returned instead of an
+// incomplete list, which would make Prometheus drop the missing targets.
+func DiscoverTargets(cfg *config.Config, client ResourceAPI) ([]TargetGroup, error) {
+	var resources []AzureResource
+	for _, target := range cfg.Resources {
+		resource, err := lookupResource(client, fmt.Sprintf("/subscriptions/%s%s", cfg.Credentials.SubscriptionID, target.Name))
+		if err != nil {
+			return nil, fmt.Errorf("Error looking up resource %s: %v", target.Name, err)
+		}
+		resources = append(resources, resource)
+	}
+	for _, target := range cfg.ResourceGroups {
+		found, err := ListResourceGroupTargets(client, target)
+		if err != nil {
+			return nil, fmt.Errorf("Error listing resources of resource group %s: %v", target.Selector(), err)
+		}
+		resources = append(resources, found...)
+	}
+
+	groups := []TargetGroup{}
+	seen := make(map[string]bool)
+	for _, resource := range resources {
+		key := strings.ToLower(resource.Id)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		labels, err := discoveryLabels(resource)
+		if err != nil {
+			log.Printf("Failed to parse target %s: %v", resource.Id, err)
+			continue
+		}
+		groups = append(groups, TargetGroup{
+			Targets: []string{resource.Id},
+			Labels:  labels,
+		})
+	}
+
+	return groups, nil
+}
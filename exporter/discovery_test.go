@@ -0,0 +1,87 @@
+package exporter
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestDiscoverTargets(t *testing.T) {
+	_, cfg, client := setupTest(t, testCredentials+`
+resources:
+  - name: /resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-1
+    metrics:
+      - Percentage CPU
+resource_groups:
+  - name: "*"
+    resource_types:
+      - Microsoft.Compute/virtualMachines
+      - Microsoft.Sql/servers/databases
+    metrics:
+      - Percentage CPU
+`)
+
+	groups, err := DiscoverTargets(cfg, client)
+	if err != nil {
+		t.Fatalf("Error discovering targets: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 target groups, got %d: %v", len(groups), groups)
+	}
+
+	var targets []string
+	for _, g := range groups {
+		targets = append(targets, g.Targets...)
+	}
+	sort.Strings(targets)
+	if targets[0] != testDB || targets[1] != testVM {
+		t.Errorf("Unexpected targets %v", targets)
+	}
+
+	for _, g := range groups {
+		if g.Targets[0] != testVM {
+			continue
+		}
+		for k, want := range map[string]string{
+			"__meta_azure_location":        "westeurope",
+			"__meta_azure_resource_group":  "web",
+			"__meta_azure_tag_Team":        "web",
+			"__meta_azure_tag_cost_center": "42",
+		} {
+			if g.Labels[k] != want {
+				t.Errorf("Expected label %s=%q, got %q", k, want, g.Labels[k])
+			}
+		}
+	}
+}
+
+// discoveryAPI looks up resources with one client and lists them with another.
+type discoveryAPI struct {
+	ResourceLookupAPI
+	ResourceListAPI
+}
+
+func TestDiscoverTargetsErrors(t *testing.T) {
+	_, cfg, client := setupTest(t, testCredentials+`
+resources:
+  - name: /resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-2
+    metrics:
+      - Percentage CPU
+resource_groups:
+  - name: data
+    resource_types:
+      - Microsoft.Sql/servers/databases
+    metrics:
+      - dtu_consumption_percent
+`)
+	if groups, err := DiscoverTargets(cfg, client); err == nil {
+		t.Errorf("Expected an error for a resource that can't be looked up, got %v", groups)
+	}
+
+	cfg.Resources = nil
+	if _, err := DiscoverTargets(cfg, client); err != nil {
+		t.Fatalf("Error discovering targets: %v", err)
+	}
+	if groups, err := DiscoverTargets(cfg, discoveryAPI{client, failingGroupAPI{client}}); err == nil {
+		t.Errorf("Expected an error for a resource group that can't be listed, got %v", groups)
+	}
+}
@@ -0,0 +1,69 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AzureAvailabilityStatusResponse represents the current availability status of a resource
+// as returned by the Resource Health API.
+type AzureAvailabilityStatusResponse struct {
+	ID         string `json:"id"`
+	Properties struct {
+		AvailabilityState string `json:"availabilityState"`
+		Summary           string `json:"summary"`
+		ReasonType        string `json:"reasonType"`
+		OccuredTime       string `json:"occuredTime"`
+	} `json:"properties"`
+}
+
+// GetAvailabilityStatus returns the current Resource Health availability status of a resource.
+func (ac *AzureClient) GetAvailabilityStatus(resource string) (AzureAvailabilityStatusResponse, error) {
+	apiVersion := "2018-07-01"
+	endpoint := fmt.Sprintf("https://management.azure.com%s/providers/Microsoft.ResourceHealth/availabilityStatuses/current?api-version=%s", resource, apiVersion)
+
+	body, err := ac.getJSON(endpoint)
+	if err != nil {
+		return AzureAvailabilityStatusResponse{}, fmt.Errorf("Unable to query resource health API: %v", err)
+	}
+
+	var data AzureAvailabilityStatusResponse
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		return AzureAvailabilityStatusResponse{}, fmt.Errorf("Error unmarshalling response body: %v", err)
+	}
+	return data, nil
+}
+
+// collectResourceHealth exports whether a resource is available according to Resource Health.
+func (c *Collector) collectResourceHealth(ch chan<- prometheus.Metric, target AzureResource) {
+	resourceID, err := ParseResourceID(target.Id)
+	if err != nil {
+		return
+	}
+
+	status, err := c.client.GetAvailabilityStatus(resourceID.ID)
+	if err != nil {
+		log.Printf("Failed to get resource health of target %s: %v", target.Id, err)
+		return
+	}
+
+	labels := CreateResourceLabels(resourceID)
+	AddTagLabels(labels, target.Tags, c.config.TagLabels)
+	labels["availability_state"] = status.Properties.AvailabilityState
+	labels["reason_type"] = status.Properties.ReasonType
+
+	available := 0.0
+	if status.Properties.AvailabilityState == "Available" {
+		available = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("azure_resource_health_available", "Whether the Azure resource is available according to Resource Health.", nil, labels),
+		prometheus.GaugeValue,
+		available,
+	)
+}
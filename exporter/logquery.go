@@ -0,0 +1,135 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AzureLogQueryResponse represents the result of a Log Analytics query.
+type AzureLogQueryResponse struct {
+	Tables []struct {
+		Name    string `json:"name"`
+		Columns []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"columns"`
+		Rows [][]interface{} `json:"rows"`
+	} `json:"tables"`
+}
+
+// QueryLogs runs a KQL query against a Log Analytics workspace, looking back for timespan,
+// an ISO 8601 duration. Results are reused until they are maxAge old. If a rerun fails,
+// the previous result is used as long as there is one.
+func (ac *AzureClient) QueryLogs(workspaceID string, query string, timespan string, maxAge time.Duration) (AzureLogQueryResponse, error) {
+	key := "log query " + strings.ToLower(workspaceID) + " " + timespan + " " + query
+
+	value, err := ac.cached(key, maxAge, func() (interface{}, error) {
+		endpoint := fmt.Sprintf("https://api.loganalytics.io/v1/workspaces/%s/query", workspaceID)
+		request := map[string]string{
+			"query":    query,
+			"timespan": timespan,
+		}
+		body, err := ac.postJSON(logAnalyticsResource, endpoint, request)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to query log analytics API: %v", err)
+		}
+
+		var result AzureLogQueryResponse
+		err = json.Unmarshal(body, &result)
+		if err != nil {
+			return nil, fmt.Errorf("Error unmarshalling response body: %v", err)
+		}
+		return result, nil
+	})
+	if err != nil {
+		return AzureLogQueryResponse{}, err
+	}
+	return value.(AzureLogQueryResponse), nil
+}
+
+// logQueryValue converts a cell of a query result to a sample value. Depending on the
+// column type, numbers are returned as JSON numbers or strings.
+func logQueryValue(cell interface{}) (float64, bool) {
+	switch v := cell.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// collectLogQueries exports the rows of the configured Log Analytics queries.
+func (c *Collector) collectLogQueries(ch chan<- prometheus.Metric) {
+	for _, q := range c.config.LogQueries {
+		result, err := c.client.QueryLogs(q.WorkspaceID, q.Query, q.ISO8601Timespan(), q.Interval)
+		if err != nil {
+			log.Printf("Failed to run log query %s: %v", q.Name, err)
+			continue
+		}
+		if len(result.Tables) == 0 {
+			continue
+		}
+		// The first table holds the result of the query.
+		table := result.Tables[0]
+
+		columns := make(map[string]int)
+		for i, column := range table.Columns {
+			columns[column.Name] = i
+		}
+		missing := false
+		for _, name := range append([]string{q.ValueColumn}, q.LabelColumns...) {
+			if _, ok := columns[name]; !ok {
+				log.Printf("Result of log query %s has no column %s", q.Name, name)
+				missing = true
+			}
+		}
+		if missing {
+			continue
+		}
+
+		desc := prometheus.NewDesc(q.MetricName(), fmt.Sprintf("Result of the log query %s.", q.Name), q.LabelColumns, nil)
+		seen := make(map[string]bool)
+		for _, row := range table.Rows {
+			if len(row) < len(table.Columns) {
+				continue
+			}
+			value, ok := logQueryValue(row[columns[q.ValueColumn]])
+			if !ok {
+				log.Printf("Skipping row of log query %s with non-numeric value %v", q.Name, row[columns[q.ValueColumn]])
+				continue
+			}
+
+			var labelValues []string
+			for _, name := range q.LabelColumns {
+				cell := row[columns[name]]
+				if cell == nil {
+					labelValues = append(labelValues, "")
+				} else {
+					labelValues = append(labelValues, fmt.Sprint(cell))
+				}
+			}
+			// Samples must be unique, so only the first row of each label combination is exported.
+			key := strings.Join(labelValues, "\xff")
+			if seen[key] {
+				log.Printf("Skipping row of log query %s with duplicate labels %v", q.Name, labelValues)
+				continue
+			}
+			seen[key] = true
+
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labelValues...)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/credativ/azure_metrics_exporter/azuretest"
+)
+
+const testWorkspace = "33333333-3333-3333-3333-333333333333"
+
+func TestCollectLogQueries(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+log_queries:
+  - name: failed_logins
+    workspace_id: `+testWorkspace+`
+    query: SigninLogs | where ResultType != 0 | summarize count() by UserPrincipalName, AppDisplayName
+    timespan: 15m
+    value_column: count_
+    label_columns:
+      - UserPrincipalName
+      - AppDisplayName
+`)
+	server.SetLogQueryResult(testWorkspace, cfg.LogQueries[0].Query, azuretest.LogQueryResult{
+		Columns: []string{"UserPrincipalName", "AppDisplayName", "count_"},
+		Rows: [][]interface{}{
+			{"alice@example.com", "Portal", 3.0},
+			{"bob@example.com", nil, "5"},
+			{"bob@example.com", nil, 7.0},
+			{"carol@example.com", "Portal", "many"},
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		metrics := gather(t, NewCollector(cfg, client))
+
+		values := make(map[string]float64)
+		for _, m := range metrics["azure_log_failed_logins"] {
+			labels := labelMap(m)
+			values[labels["UserPrincipalName"]+"/"+labels["AppDisplayName"]] = m.GetGauge().GetValue()
+		}
+		if len(values) != 2 || values["alice@example.com/Portal"] != 3 || values["bob@example.com/"] != 5 {
+			t.Errorf("Unexpected failed logins: %v", values)
+		}
+	}
+
+	if queries := server.CountRequests("/v1/workspaces/" + testWorkspace + "/query"); queries != 1 {
+		t.Errorf("Expected the query to be run once, got %d queries", queries)
+	}
+}
+
+func TestCollectFailedLogQuery(t *testing.T) {
+	_, cfg, client := setupTest(t, testCredentials+`
+log_queries:
+  - name: heartbeats
+    workspace_id: `+testWorkspace+`
+    query: Heartbeat | count
+    value_column: Count
+`)
+
+	metrics := gather(t, NewCollector(cfg, client))
+
+	if len(metrics["azure_log_heartbeats"]) != 0 {
+		t.Errorf("Expected no results of a failed query, got %v", metrics["azure_log_heartbeats"])
+	}
+}
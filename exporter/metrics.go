@@ -0,0 +1,163 @@
+package exporter
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/credativ/azure_metrics_exporter/config"
+)
+
+// The metrics API accepts at most this many metric names per request.
+const maxMetricsPerRequest = 20
+
+// Aggregation used for metrics selected by "metrics: all" whose primary
+// aggregation type is not one of the aggregations supported by the exporter.
+const FallbackAggregation = "Average"
+
+// DefaultTimeGrain is the time grain queried for metrics without a known definition.
+const DefaultTimeGrain = time.Minute
+
+// timeGrains are the time grains of the metrics API, which are given as ISO 8601 durations.
+var timeGrains = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"PT1M", time.Minute},
+	{"PT5M", 5 * time.Minute},
+	{"PT15M", 15 * time.Minute},
+	{"PT30M", 30 * time.Minute},
+	{"PT1H", time.Hour},
+	{"PT6H", 6 * time.Hour},
+	{"PT12H", 12 * time.Hour},
+	{"P1D", 24 * time.Hour},
+}
+
+// formatTimeGrain returns the ISO 8601 duration of a time grain.
+func formatTimeGrain(d time.Duration) string {
+	for _, g := range timeGrains {
+		if g.duration == d {
+			return g.name
+		}
+	}
+	return "PT1M"
+}
+
+// metricTimeGrain returns the smallest time grain a metric is available in.
+func metricTimeGrain(def AzureMetricDefinition) time.Duration {
+	var grain time.Duration
+	for _, a := range def.MetricAvailabilities {
+		for _, g := range timeGrains {
+			if strings.EqualFold(g.name, a.TimeGrain) && (grain == 0 || g.duration < grain) {
+				grain = g.duration
+			}
+		}
+	}
+	if grain == 0 {
+		return DefaultTimeGrain
+	}
+	return grain
+}
+
+// metricRequest is a set of metrics that are queried with the same aggregations and
+// time grain in one request.
+type metricRequest struct {
+	metrics      []string
+	aggregations []string
+	timeGrain    time.Duration
+}
+
+// splitMetricRequests splits metrics into requests of at most maxMetricsPerRequest names.
+func splitMetricRequests(metrics []string, aggregations []string, timeGrain time.Duration) []metricRequest {
+	var requests []metricRequest
+	for len(metrics) > 0 {
+		n := len(metrics)
+		if n > maxMetricsPerRequest {
+			n = maxMetricsPerRequest
+		}
+		requests = append(requests, metricRequest{metrics: metrics[:n], aggregations: aggregations, timeGrain: timeGrain})
+		metrics = metrics[n:]
+	}
+	return requests
+}
+
+// resolveMetricRequests returns the requests needed to query the metrics of a target
+// for a resource. For "metrics: all", the metrics defined for the resource type are
+// selected, each with its primary aggregation unless aggregations are configured.
+// Each metric is queried in the smallest time grain it is defined for.
+func (c *metricCollector) resolveMetricRequests(resourceID *ResourceID, namespace string, metrics config.MetricList, aggregations []string, selects func(string) bool) ([]metricRequest, error) {
+	definitions, err := c.client.GetMetricDefinitions(resourceID, namespace)
+	if err != nil {
+		if metrics.All() {
+			return nil, err
+		}
+		log.Printf("Failed to get metric definitions for target %s, using time grain %s: %v", resourceID.ID, formatTimeGrain(DefaultTimeGrain), err)
+	}
+
+	// Group the metrics by aggregations and time grain, keeping the order of the
+	// configuration or the definitions.
+	type requestKey struct {
+		aggregations string
+		timeGrain    time.Duration
+	}
+	var order []requestKey
+	byKey := make(map[requestKey]*metricRequest)
+	add := func(name string, metricAggregations []string, timeGrain time.Duration) {
+		key := requestKey{strings.Join(metricAggregations, ","), timeGrain}
+		r, ok := byKey[key]
+		if !ok {
+			order = append(order, key)
+			r = &metricRequest{aggregations: metricAggregations, timeGrain: timeGrain}
+			byKey[key] = r
+		}
+		r.metrics = append(r.metrics, name)
+	}
+
+	if !metrics.All() {
+		grains := make(map[string]time.Duration)
+		for _, def := range definitions.MetricDefinitionResponses {
+			grains[strings.ToLower(def.Name.Value)] = metricTimeGrain(def)
+		}
+		for _, name := range metrics {
+			grain, ok := grains[strings.ToLower(name)]
+			if !ok {
+				grain = DefaultTimeGrain
+			}
+			add(name, aggregations, grain)
+		}
+	} else {
+		for _, def := range definitions.MetricDefinitionResponses {
+			name := def.Name.Value
+			if !selects(name) {
+				continue
+			}
+
+			metricAggregations := aggregations
+			if len(metricAggregations) == 0 {
+				primary := def.PrimaryAggregationType
+				if !IsSupportedAggregation(primary) {
+					primary = FallbackAggregation
+				}
+				metricAggregations = []string{primary}
+			}
+			add(name, metricAggregations, metricTimeGrain(def))
+		}
+	}
+
+	var requests []metricRequest
+	for _, key := range order {
+		r := byKey[key]
+		requests = append(requests, splitMetricRequests(r.metrics, r.aggregations, r.timeGrain)...)
+	}
+	return requests, nil
+}
+
+// IsSupportedAggregation reports whether the exporter can export an aggregation type.
+func IsSupportedAggregation(aggregation string) bool {
+	for _, a := range []string{"Total", "Average", "Minimum", "Maximum"} {
+		if a == aggregation {
+			return true
+		}
+	}
+	return false
+}
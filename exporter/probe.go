@@ -0,0 +1,39 @@
+package exporter
+
+import (
+	"github.com/credativ/azure_metrics_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ProbeCollector collects the metrics of a single resource requested via /probe.
+type ProbeCollector struct {
+	metrics  *metricCollector
+	client   ProbeAPI
+	resource string
+	module   config.Module
+}
+
+// NewProbeCollector returns a collector for the metrics and aggregations selected by
+// module of a single resource, identified by its full ID.
+func NewProbeCollector(cfg *config.Config, client ProbeAPI, resource string, module config.Module) *ProbeCollector {
+	return &ProbeCollector{
+		metrics:  &metricCollector{config: cfg, client: client},
+		client:   client,
+		resource: resource,
+		module:   module,
+	}
+}
+
+// Describe sends no descriptors, which makes the collector unchecked. The exported
+// metrics depend on the resources found in Azure, and several collectors can be
+// registered side by side.
+func (p *ProbeCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+// Collect - collect results for the probed resource from Azure Monitor API.
+func (p *ProbeCollector) Collect(ch chan<- prometheus.Metric) {
+	resource := LookupResource(p.client, p.resource)
+
+	p.metrics.collectResourceInfo(ch, resource)
+	p.metrics.collectTarget(ch, resource, p.module.Namespace, config.MetricList(p.module.Metrics), p.module.Aggregations, func(string) bool { return true }, p.module.MetricNullPolicy)
+}
@@ -0,0 +1,108 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AzureUsageListResponse represents the usage of the subscription quotas of a
+// resource provider in a location.
+type AzureUsageListResponse struct {
+	Value []struct {
+		Name struct {
+			Value          string `json:"value"`
+			LocalizedValue string `json:"localizedValue"`
+		} `json:"name"`
+		Unit         string  `json:"unit"`
+		CurrentValue float64 `json:"currentValue"`
+		Limit        float64 `json:"limit"`
+	} `json:"value"`
+	NextLink string `json:"nextLink"`
+}
+
+// usagesAPIVersions are the API versions of the usages endpoints of the supported providers.
+var usagesAPIVersions = map[string]string{
+	"Microsoft.Compute": "2019-07-01",
+	"Microsoft.Network": "2019-11-01",
+	"Microsoft.Storage": "2019-06-01",
+}
+
+// GetUsages returns the usage and limits of the subscription quotas of a resource
+// provider, e.g. Microsoft.Compute, in a location.
+func (ac *AzureClient) GetUsages(provider string, location string) (AzureUsageListResponse, error) {
+	apiVersion, ok := usagesAPIVersions[provider]
+	if !ok {
+		return AzureUsageListResponse{}, fmt.Errorf("Provider %s has no usages API", provider)
+	}
+	endpoint := fmt.Sprintf("https://management.azure.com/subscriptions/%s/providers/%s/locations/%s/usages?api-version=%s", ac.credentials.SubscriptionID, provider, location, apiVersion)
+
+	var usages AzureUsageListResponse
+	for endpoint != "" {
+		body, err := ac.getJSON(endpoint)
+		if err != nil {
+			return AzureUsageListResponse{}, fmt.Errorf("Unable to query usages API: %v", err)
+		}
+
+		var page AzureUsageListResponse
+		err = json.Unmarshal(body, &page)
+		if err != nil {
+			return AzureUsageListResponse{}, fmt.Errorf("Error unmarshalling response body: %v", err)
+		}
+		usages.Value = append(usages.Value, page.Value...)
+		endpoint = page.NextLink
+	}
+
+	return usages, nil
+}
+
+// collectQuotas exports the usage and limits of the subscription quotas. Unless locations
+// are configured, they are exported for the given locations of the collected resources.
+func (c *Collector) collectQuotas(ch chan<- prometheus.Metric, resourceLocations map[string]bool) {
+	quotas := c.config.Quotas
+	if quotas == nil {
+		return
+	}
+
+	locations := quotas.Locations
+	if len(locations) == 0 {
+		for location := range resourceLocations {
+			locations = append(locations, location)
+		}
+		sort.Strings(locations)
+	}
+
+	subscriptionID := c.config.Credentials.SubscriptionID
+	for _, location := range locations {
+		for _, provider := range quotas.Providers {
+			usages, err := c.client.GetUsages(provider, location)
+			if err != nil {
+				log.Printf("Failed to get quotas of %s in %s: %v", provider, location, err)
+				continue
+			}
+
+			for _, usage := range usages.Value {
+				labels := map[string]string{
+					"subscription_id": subscriptionID,
+					"provider":        provider,
+					"location":        location,
+					"quota":           usage.Name.Value,
+				}
+
+				ch <- prometheus.MustNewConstMetric(
+					prometheus.NewDesc("azure_quota_usage", "Current usage of a subscription quota.", nil, labels),
+					prometheus.GaugeValue,
+					usage.CurrentValue,
+				)
+				ch <- prometheus.MustNewConstMetric(
+					prometheus.NewDesc("azure_quota_limit", "Limit of a subscription quota.", nil, labels),
+					prometheus.GaugeValue,
+					usage.Limit,
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/credativ/azure_metrics_exporter/azuretest"
+)
+
+func TestCollectQuotas(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+resources:
+  - name: /resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-1
+    metrics:
+      - Percentage CPU
+resource_groups:
+  - name: data
+    resource_types:
+      - Microsoft.Sql/servers/databases
+    metrics:
+      - dtu_consumption_percent
+quotas:
+  providers:
+    - microsoft.compute
+    - Microsoft.Network
+`)
+	server.SetUsages("Microsoft.Compute", "westeurope", azuretest.Usage{Name: "cores", Unit: "Count", CurrentValue: 18, Limit: 20})
+	server.SetUsages("Microsoft.Network", "northeurope", azuretest.Usage{Name: "PublicIPAddresses", Unit: "Count", CurrentValue: 3, Limit: 10})
+	server.SetUsages("Microsoft.Storage", "westeurope", azuretest.Usage{Name: "StorageAccounts", Unit: "Count", CurrentValue: 1, Limit: 250})
+
+	metrics := gather(t, NewCollector(cfg, client))
+
+	usage := make(map[string]float64)
+	for _, m := range metrics["azure_quota_usage"] {
+		labels := labelMap(m)
+		if labels["subscription_id"] != testSubscription {
+			t.Errorf("Unexpected labels: %v", labels)
+		}
+		usage[labels["provider"]+"/"+labels["location"]+"/"+labels["quota"]] = m.GetGauge().GetValue()
+	}
+	if len(usage) != 2 || usage["Microsoft.Compute/westeurope/cores"] != 18 || usage["Microsoft.Network/northeurope/PublicIPAddresses"] != 3 {
+		t.Errorf("Unexpected quota usage: %v", usage)
+	}
+
+	limits := metrics["azure_quota_limit"]
+	if len(limits) != 2 {
+		t.Fatalf("Expected 2 quota limits, got %v", limits)
+	}
+	for _, m := range limits {
+		if labelMap(m)["quota"] == "cores" && m.GetGauge().GetValue() != 20 {
+			t.Errorf("Unexpected limit of cores: %v", m)
+		}
+	}
+}
+
+func TestCollectQuotasOfConfiguredLocations(t *testing.T) {
+	server, cfg, client := setupTest(t, testCredentials+`
+quotas:
+  providers:
+    - Microsoft.Storage
+  locations:
+    - West Europe
+`)
+	server.SetUsages("Microsoft.Storage", "westeurope", azuretest.Usage{Name: "StorageAccounts", Unit: "Count", CurrentValue: 1, Limit: 250})
+
+	metrics := gather(t, NewCollector(cfg, client))
+
+	if len(metrics["azure_quota_limit"]) != 1 || metrics["azure_quota_limit"][0].GetGauge().GetValue() != 250 {
+		t.Errorf("Unexpected quota limits: %v", metrics["azure_quota_limit"])
+	}
+}
@@ -0,0 +1,76 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResourceID - The parts of an Azure Resource Manager resource ID.
+type ResourceID struct {
+	// ID is the full resource ID the other fields were parsed from.
+	ID             string
+	SubscriptionID string
+	ResourceGroup  string
+	// Provider is the resource provider namespace, e.g. "Microsoft.Sql".
+	Provider string
+	// ResourceType is the full type including parent types, e.g. "Microsoft.Sql/servers/databases".
+	ResourceType string
+	// Parents holds the "type/name" pairs of all parent resources, outermost first.
+	Parents []string
+	Name    string
+}
+
+// ParseResourceID - Parses an ARM resource ID of the form
+// /subscriptions/{sub}/resourceGroups/{group}/providers/{namespace}/{type}/{name}[/{type}/{name}...].
+// Extension resources (a nested /providers/ segment, as found in metric IDs) are
+// attributed to the resource they extend.
+func ParseResourceID(id string) (*ResourceID, error) {
+	parts := strings.Split(strings.Trim(id, "/"), "/")
+	if len(parts)%2 != 0 {
+		return nil, fmt.Errorf("Resource ID %q has an odd number of segments", id)
+	}
+
+	r := &ResourceID{}
+	var types, names []string
+	end := len(parts)
+	for i := 0; i < end; i += 2 {
+		key, value := parts[i], parts[i+1]
+		if value == "" {
+			return nil, fmt.Errorf("Resource ID %q has an empty %s segment", id, key)
+		}
+
+		if r.Provider == "" {
+			switch strings.ToLower(key) {
+			case "subscriptions":
+				r.SubscriptionID = value
+			case "resourcegroups":
+				r.ResourceGroup = value
+			case "providers":
+				r.Provider = value
+			default:
+				return nil, fmt.Errorf("Resource ID %q has unexpected segment %q", id, key)
+			}
+			continue
+		}
+
+		if strings.EqualFold(key, "providers") {
+			end = i
+			break
+		}
+		types = append(types, key)
+		names = append(names, value)
+	}
+
+	if r.Provider == "" || len(types) == 0 {
+		return nil, fmt.Errorf("Resource ID %q does not identify a provider resource", id)
+	}
+
+	for i := 0; i < len(types)-1; i++ {
+		r.Parents = append(r.Parents, types[i]+"/"+names[i])
+	}
+	r.ID = "/" + strings.Join(parts[:end], "/")
+	r.ResourceType = r.Provider + "/" + strings.Join(types, "/")
+	r.Name = names[len(names)-1]
+
+	return r, nil
+}
@@ -0,0 +1,72 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseResourceID(t *testing.T) {
+	for _, tc := range []struct {
+		id   string
+		want ResourceID
+	}{
+		{
+			id: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm",
+			want: ResourceID{
+				ID:             "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm",
+				SubscriptionID: "sub",
+				ResourceGroup:  "rg",
+				Provider:       "Microsoft.Compute",
+				ResourceType:   "Microsoft.Compute/virtualMachines",
+				Name:           "vm",
+			},
+		},
+		{
+			id: "/subscriptions/sub/resourcegroups/rg/providers/Microsoft.Sql/servers/srv/databases/db",
+			want: ResourceID{
+				ID:             "/subscriptions/sub/resourcegroups/rg/providers/Microsoft.Sql/servers/srv/databases/db",
+				SubscriptionID: "sub",
+				ResourceGroup:  "rg",
+				Provider:       "Microsoft.Sql",
+				ResourceType:   "Microsoft.Sql/servers/databases",
+				Parents:        []string{"servers/srv"},
+				Name:           "db",
+			},
+		},
+		{
+			id: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Web/sites/app/providers/Microsoft.Insights/metrics/Requests",
+			want: ResourceID{
+				ID:             "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Web/sites/app",
+				SubscriptionID: "sub",
+				ResourceGroup:  "rg",
+				Provider:       "Microsoft.Web",
+				ResourceType:   "Microsoft.Web/sites",
+				Name:           "app",
+			},
+		},
+	} {
+		got, err := ParseResourceID(tc.id)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %q: %v", tc.id, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tc.want) {
+			t.Errorf("ParseResourceID(%q) = %+v, want %+v", tc.id, *got, tc.want)
+		}
+	}
+}
+
+func TestParseResourceIDErrors(t *testing.T) {
+	for _, id := range []string{
+		"",
+		"/subscriptions/sub/resourceGroups/rg",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines",
+		"/subscriptions/sub/resourceGroups//providers/Microsoft.Compute/virtualMachines/vm",
+		"/subscriptions/sub/foo/bar/providers/Microsoft.Compute/virtualMachines/vm",
+	} {
+		if _, err := ParseResourceID(id); err == nil {
+			t.Errorf("Expected error parsing %q", id)
+		}
+	}
+}
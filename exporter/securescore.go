@@ -0,0 +1,91 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AzureSecureScore represents a Defender for Cloud secure score.
+type AzureSecureScore struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Properties struct {
+		DisplayName string `json:"displayName"`
+		Score       struct {
+			Max        float64 `json:"max"`
+			Current    float64 `json:"current"`
+			Percentage float64 `json:"percentage"`
+		} `json:"score"`
+		Weight float64 `json:"weight"`
+	} `json:"properties"`
+}
+
+// AzureSecureScoreListResponse represents a page of secure scores.
+type AzureSecureScoreListResponse struct {
+	Value    []AzureSecureScore `json:"value"`
+	NextLink string             `json:"nextLink"`
+}
+
+// ListSecureScores returns the Defender for Cloud secure scores of the subscription.
+// As they change slowly, results are reused until they are maxAge old.
+func (ac *AzureClient) ListSecureScores(maxAge time.Duration) ([]AzureSecureScore, error) {
+	value, err := ac.cached("secure scores", maxAge, func() (interface{}, error) {
+		apiVersion := "2020-01-01"
+		endpoint := fmt.Sprintf("https://management.azure.com/subscriptions/%s/providers/Microsoft.Security/secureScores?api-version=%s", ac.credentials.SubscriptionID, apiVersion)
+
+		var scores []AzureSecureScore
+		for endpoint != "" {
+			body, err := ac.getJSON(endpoint)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to query secure score API: %v", err)
+			}
+
+			var page AzureSecureScoreListResponse
+			err = json.Unmarshal(body, &page)
+			if err != nil {
+				return nil, fmt.Errorf("Error unmarshalling response body: %v", err)
+			}
+			scores = append(scores, page.Value...)
+			endpoint = page.NextLink
+		}
+		return scores, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]AzureSecureScore), nil
+}
+
+// collectSecureScore exports the current and maximum Defender for Cloud secure scores.
+func (c *Collector) collectSecureScore(ch chan<- prometheus.Metric) {
+	if c.config.SecureScore == nil {
+		return
+	}
+
+	scores, err := c.client.ListSecureScores(c.config.SecureScore.Interval)
+	if err != nil {
+		log.Printf("Failed to list secure scores: %v", err)
+		return
+	}
+
+	for _, s := range scores {
+		labels := prometheus.Labels{
+			"subscription_id": c.config.Credentials.SubscriptionID,
+			"score":           s.Name,
+		}
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc("azure_secure_score_current", "Current Defender for Cloud secure score.", nil, labels),
+			prometheus.GaugeValue,
+			s.Properties.Score.Current,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc("azure_secure_score_max", "Maximum Defender for Cloud secure score.", nil, labels),
+			prometheus.GaugeValue,
+			s.Properties.Score.Max,
+		)
+	}
+}
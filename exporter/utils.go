@@ -0,0 +1,110 @@
+package exporter
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/credativ/azure_metrics_exporter/config"
+)
+
+// MetricWindow is the time window queried for the latest value of App Insights metrics.
+const MetricWindow = time.Minute
+
+// NullPolicyLastGrains is the number of time grains queried for metrics with the null
+// policy last, so older values can be exported when the latest time grain has no data.
+const NullPolicyLastGrains = 7
+
+// GetTimes - Returns the endTime and startTime used for querying Azure Metrics API
+// for the given time window
+func GetTimes(window time.Duration) (string, string) {
+	// Make sure we are using UTC
+	now := time.Now().UTC()
+
+	// Use query delay of 3 minutes when querying for latest metric data
+	end := now.Add(time.Minute * time.Duration(-3))
+	endTime := end.Format(time.RFC3339)
+	startTime := end.Add(-window).Format(time.RFC3339)
+	return endTime, startTime
+}
+
+var invalidMetricChars = regexp.MustCompile("[^a-zA-Z0-9_:]")
+
+// PrometheusMetricName - Ensures Azure metric names conform to Prometheus metric name conventions.
+func PrometheusMetricName(name string, unit string) string {
+	metricName := strings.Replace(name, " ", "_", -1)
+	metricName = strings.ToLower(metricName + "_" + unit)
+	metricName = strings.Replace(metricName, "/", "_per_", -1)
+	return invalidMetricChars.ReplaceAllString(metricName, "_")
+}
+
+// CreateResourceLabels - Returns resource labels for a given parsed resource ID.
+// Every resource gets the same set of labels so metric families stay consistent.
+func CreateResourceLabels(resource *ResourceID) map[string]string {
+	labels := make(map[string]string)
+	labels["resource_id"] = resource.ID
+	labels["subscription_id"] = resource.SubscriptionID
+	labels["resource_group"] = resource.ResourceGroup
+	labels["resource_type"] = resource.ResourceType
+	labels["resource_name"] = resource.Name
+	return labels
+}
+
+// AddTagLabels - Adds a label for each configured tag, using an empty value for missing tags.
+// Azure tag names are case-insensitive, so they are matched accordingly.
+func AddTagLabels(labels map[string]string, tags map[string]string, tagLabels map[string]string) {
+	for tagName, labelName := range tagLabels {
+		labels[labelName] = ""
+		for k, v := range tags {
+			if strings.EqualFold(k, tagName) {
+				labels[labelName] = v
+				break
+			}
+		}
+	}
+}
+
+// AddDimensionLabels - Returns a copy of labels with a dimension_<name> label for each
+// dimension value of the timeseries.
+func AddDimensionLabels(labels map[string]string, timeseries AzureTimeseries) map[string]string {
+	result := make(map[string]string, len(labels)+len(timeseries.Metadatavalues))
+	for k, v := range labels {
+		result[k] = v
+	}
+	for _, m := range timeseries.Metadatavalues {
+		name := strings.ToLower(invalidLabelChars.ReplaceAllString(m.Name.Value, "_"))
+		result["dimension_"+name] = m.Value
+	}
+	return result
+}
+
+// LatestValue - Returns the current value of an aggregation in the data points of a
+// timeseries, or nil if there is none according to the null policy.
+func LatestValue(data []AzureDataPoint, aggregation string, nullPolicy string) *float64 {
+	if len(data) == 0 {
+		return nil
+	}
+	if nullPolicy != config.NullPolicyLast {
+		return data[len(data)-1].Aggregation(aggregation)
+	}
+
+	for i := len(data) - 1; i >= 0; i-- {
+		if v := data[i].Aggregation(aggregation); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+func hasAggregation(aggregations []string, aggregation string) bool {
+	if len(aggregations) == 0 {
+		return true
+	}
+
+	for _, aggr := range aggregations {
+		if aggr == aggregation {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/credativ/azure_metrics_exporter/config"
+)
+
+func TestPrometheusMetricName(t *testing.T) {
+	for _, tc := range []struct {
+		name, unit, want string
+	}{
+		{"Percentage CPU", "Percent", "percentage_cpu_percent"},
+		{"Disk Read Operations/Sec", "CountPerSecond", "disk_read_operations_per_sec_countpersecond"},
+		{"dtu_consumption_percent", "Percent", "dtu_consumption_percent_percent"},
+		{"Http5xx", "Count", "http5xx_count"},
+		{"Data Usage (GB)", "Bytes", "data_usage__gb__bytes"},
+	} {
+		if got := PrometheusMetricName(tc.name, tc.unit); got != tc.want {
+			t.Errorf("PrometheusMetricName(%q, %q) = %q, want %q", tc.name, tc.unit, got, tc.want)
+		}
+	}
+}
+
+func TestAddTagLabels(t *testing.T) {
+	labels := map[string]string{}
+	AddTagLabels(labels,
+		map[string]string{"Environment": "prod"},
+		map[string]string{"environment": "env", "owner": "owner"},
+	)
+
+	if labels["env"] != "prod" {
+		t.Errorf("Expected tags to be matched case-insensitively, got %q", labels["env"])
+	}
+	if v, ok := labels["owner"]; !ok || v != "" {
+		t.Errorf("Expected missing tag to result in an empty label, got %q", v)
+	}
+}
+
+func TestLatestValue(t *testing.T) {
+	one, two := 1.0, 2.0
+	data := []AzureDataPoint{
+		{Average: &one, Total: &one},
+		{Average: &two},
+		{},
+	}
+
+	for _, tc := range []struct {
+		aggregation string
+		policy      string
+		want        *float64
+	}{
+		{"Average", config.NullPolicyLast, &two},
+		{"Total", config.NullPolicyLast, &one},
+		{"Maximum", config.NullPolicyLast, nil},
+		{"Average", config.NullPolicySkip, nil},
+		{"Average", config.NullPolicyNaN, nil},
+	} {
+		got := LatestValue(data, tc.aggregation, tc.policy)
+		if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+			t.Errorf("LatestValue(%s, %s) = %v, want %v", tc.aggregation, tc.policy, got, tc.want)
+		}
+	}
+
+	if got := LatestValue(nil, "Average", config.NullPolicyLast); got != nil {
+		t.Errorf("Expected no value without data points, got %v", *got)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/credativ/azure_metrics_exporter/config"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	recordDir = kingpin.Flag("azure.record-dir", "Record all Azure API responses as fixture files into this directory. Tokens and IDs of the configured credentials are redacted.").PlaceHolder("DIR").String()
+	replayDir = kingpin.Flag("azure.replay-dir", "Answer Azure API requests from fixture files recorded with --azure.record-dir instead of contacting Azure.").PlaceHolder("DIR").String()
+)
+
+// Placeholders replacing the IDs of the configured credentials in fixtures.
+const (
+	redactedSubscriptionID = "00000000-0000-0000-0000-000000000000"
+	redactedTenantID       = "11111111-1111-1111-1111-111111111111"
+	redactedClientID       = "22222222-2222-2222-2222-222222222222"
+	redactedAccessToken    = "<redacted>"
+)
+
+// fixture is a recorded response to an Azure API request.
+type fixture struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+	Body   string `json:"body"`
+}
+
+// redactor replaces the IDs of the configured credentials with placeholders and back.
+type redactor struct {
+	ids map[string]string
+}
+
+func newRedactor(credentials config.Credentials) redactor {
+	ids := make(map[string]string)
+	for id, placeholder := range map[string]string{
+		credentials.SubscriptionID: redactedSubscriptionID,
+		credentials.TenantID:       redactedTenantID,
+		credentials.ClientID:       redactedClientID,
+	} {
+		if id != "" {
+			ids[id] = placeholder
+		}
+	}
+	return redactor{ids: ids}
+}
+
+// redact removes access tokens and configured IDs from s.
+func (r redactor) redact(s string) string {
+	s = accessTokenValue.ReplaceAllString(s, fmt.Sprintf(`"access_token":%q`, redactedAccessToken))
+	for id, placeholder := range r.ids {
+		s = regexp.MustCompile("(?i)"+regexp.QuoteMeta(id)).ReplaceAllLiteralString(s, placeholder)
+	}
+	return s
+}
+
+// restore puts the configured IDs back in place of the placeholders in s.
+func (r redactor) restore(s string) string {
+	for id, placeholder := range r.ids {
+		s = strings.Replace(s, placeholder, id, -1)
+	}
+	return s
+}
+
+// fixtureURL returns the redacted URL of req. The timespan of metric requests
+// changes with every scrape and is left out.
+func (r redactor) fixtureURL(req *http.Request) string {
+	u := *req.URL
+	query := u.Query()
+	query.Del("timespan")
+	u.RawQuery = query.Encode()
+	return r.redact(u.String())
+}
+
+// fixtureKey identifies a request independently of the time it was made at.
+// JSON request bodies, e.g. of cost queries, are part of the key.
+func (r redactor) fixtureKey(req *http.Request) (string, error) {
+	key := req.Method + " " + r.fixtureURL(req)
+	if req.Body == nil || req.Header.Get("Content-Type") != "application/json" {
+		return key, nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("Error reading request body: %v", err)
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return key + " " + r.redact(string(body)), nil
+}
+
+// fixtureFile returns the file a response to req is stored in.
+func fixtureFile(dir, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	method := strings.ToLower(strings.SplitN(key, " ", 2)[0])
+	return filepath.Join(dir, method+"-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// recordingTransport stores redacted copies of all responses in dir.
+type recordingTransport struct {
+	next     http.RoundTripper
+	dir      string
+	redactor func() redactor
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := t.redactor()
+	key, err := r.fixtureKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	f := fixture{
+		Method: req.Method,
+		URL:    r.fixtureURL(req),
+		Status: resp.StatusCode,
+		Body:   r.redact(string(body)),
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return nil, fmt.Errorf("Error creating fixture directory: %v", err)
+	}
+	if err := ioutil.WriteFile(fixtureFile(t.dir, key), append(data, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("Error writing fixture: %v", err)
+	}
+
+	return resp, nil
+}
+
+// replayTransport answers requests from fixtures stored by recordingTransport.
+type replayTransport struct {
+	dir      string
+	redactor func() redactor
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := t.redactor()
+	key, err := r.fixtureKey(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(fixtureFile(t.dir, key))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("No recorded response for %s", key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading fixture: %v", err)
+	}
+
+	var f fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("Error decoding fixture %s: %v", fixtureFile(t.dir, key), err)
+	}
+
+	body := r.restore(f.Body)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+		StatusCode:    f.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// configuredRedactor redacts the credentials of the currently loaded config.
+func configuredRedactor() redactor {
+	return newRedactor(sc.Get().Credentials)
+}
+
+// enableFixtures sets up recording or replaying of Azure API responses as
+// requested on the command line.
+func enableFixtures() {
+	switch {
+	case *recordDir != "" && *replayDir != "":
+		kingpin.Fatalf("--azure.record-dir and --azure.replay-dir are mutually exclusive")
+	case *recordDir != "":
+		next := httpClient.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		httpClient.Transport = &recordingTransport{next: next, dir: *recordDir, redactor: configuredRedactor}
+	case *replayDir != "":
+		httpClient.Transport = &replayTransport{dir: *replayDir, redactor: configuredRedactor}
+	}
+}
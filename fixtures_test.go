@@ -0,0 +1,132 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/credativ/azure_metrics_exporter/azuretest"
+	"github.com/credativ/azure_metrics_exporter/config"
+	"github.com/credativ/azure_metrics_exporter/exporter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	testSubscription = "6a1c5f0e-0c11-4d9b-9f4e-2c2a3c5b7d01"
+	testTenant       = "9f3c1a2b-4d5e-4f60-8a7b-1c2d3e4f5a6b"
+	testClient       = "4b2e8c1d-7a3f-4e5d-9c6b-0a1b2c3d4e5f"
+	testVM           = "/subscriptions/" + testSubscription + "/resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-1"
+)
+
+const testConfig = `
+credentials:
+  subscription_id: ` + testSubscription + `
+  tenant_id: ` + testTenant + `
+  client_id: ` + testClient + `
+  client_secret: secret
+resources:
+  - name: /resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-1
+    metrics:
+      - Percentage CPU
+`
+
+// scrapeText collects the configured resources and returns the metrics in the text format.
+func scrapeText(t *testing.T, cfg *config.Config, client *http.Client) string {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter.NewCollector(cfg, exporter.NewAzureClient(cfg.Credentials, client)))
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Error gathering metrics: %v", err)
+	}
+
+	var b strings.Builder
+	for _, mf := range families {
+		expfmt.MetricFamilyToText(&b, mf)
+	}
+	return b.String()
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "azure.yml")
+	if err := ioutil.WriteFile(file, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(file)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	redact := func() redactor { return newRedactor(cfg.Credentials) }
+
+	server := azuretest.NewServer()
+	defer server.Close()
+	server.AddResource(azuretest.Resource{ID: testVM, Location: "westeurope"})
+	server.SetMetric(testVM, azuretest.Metric{Name: "Percentage CPU", Unit: "Percent", Timeseries: []azuretest.Timeseries{
+		{Data: []azuretest.DataPoint{{"average": 12.5, "minimum": 3, "maximum": 40, "total": 25}}},
+	}})
+
+	dir := t.TempDir()
+	client := server.Client()
+	client.Transport = &recordingTransport{next: client.Transport, dir: dir, redactor: redact}
+	recorded := scrapeText(t, cfg, client)
+	if !strings.Contains(recorded, "percentage_cpu_percent_average") {
+		t.Fatalf("Expected metrics to be collected while recording, got:\n%s", recorded)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Errorf("Expected fixtures for token, resource, metric definition and metric requests, got %d", len(files))
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{testSubscription, testTenant, testClient, azuretest.AccessToken} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("Fixture %s contains unredacted %q", file, secret)
+			}
+		}
+	}
+
+	// Replaying must not need the server anymore.
+	server.Close()
+	replayed := scrapeText(t, cfg, &http.Client{Transport: &replayTransport{dir: dir, redactor: redact}})
+	if replayed != recorded {
+		t.Errorf("Replayed metrics differ from recorded ones:\n%s\nwant:\n%s", replayed, recorded)
+	}
+}
+
+func TestReplayMissingFixture(t *testing.T) {
+	credentials := config.Credentials{SubscriptionID: testSubscription, TenantID: testTenant, ClientID: testClient}
+	transport := &replayTransport{dir: t.TempDir(), redactor: func() redactor { return newRedactor(credentials) }}
+	client := exporter.NewAzureClient(credentials, &http.Client{Transport: transport})
+
+	_, err := client.RefreshAccessToken()
+	if err == nil || !strings.Contains(err.Error(), "No recorded response") {
+		t.Errorf("Expected missing fixture error, got %v", err)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	r := newRedactor(config.Credentials{SubscriptionID: testSubscription})
+
+	id := "/subscriptions/" + strings.ToUpper(testSubscription) + "/resourceGroups/web"
+	redacted := r.redact(id)
+	if redacted != "/subscriptions/"+redactedSubscriptionID+"/resourceGroups/web" {
+		t.Errorf("Unexpected redacted ID %q", redacted)
+	}
+	if restored := r.restore(redacted); !strings.EqualFold(restored, id) {
+		t.Errorf("Unexpected restored ID %q", restored)
+	}
+
+	token := r.redact(`{"token_type":"Bearer","access_token": "abc.def"}`)
+	if strings.Contains(token, "abc.def") {
+		t.Errorf("Access token not redacted: %s", token)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/credativ/azure_metrics_exporter/config"
+	"github.com/credativ/azure_metrics_exporter/exporter"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	generateCommand        = kingpin.Command("generate-config", "Discover resources and write a config file with all of their metrics.")
+	generateSubscription   = generateCommand.Flag("subscription", "Subscription ID to discover resources in. Defaults to the one of the config file.").String()
+	generateResourceGroups = generateCommand.Flag("resource-group", "Resource group to discover resources in, may be a glob pattern. Can be repeated, defaults to all resource groups.").Strings()
+	generateResourceTypes  = generateCommand.Flag("type", "Resource type to discover, e.g. Microsoft.Web/sites. Can be repeated.").Required().Strings()
+	generateTenantID       = generateCommand.Flag("tenant-id", "Azure AD tenant ID. Defaults to the one of the config file.").Envar("AZURE_TENANT_ID").String()
+	generateClientID       = generateCommand.Flag("client-id", "Client ID of the service principal. Defaults to the one of the config file.").Envar("AZURE_CLIENT_ID").String()
+	generateClientSecret   = generateCommand.Flag("client-secret", "Client secret of the service principal. Defaults to the one of the config file.").Envar("AZURE_CLIENT_SECRET").String()
+	generateOutput         = generateCommand.Flag("output", "File to write the config to, - for stdout.").Short('o').Default("-").String()
+)
+
+// generatedMetric is a metric of a generated resource_groups entry.
+type generatedMetric struct {
+	Name       string
+	Dimensions []string
+}
+
+// generatedResourceGroup is a resource_groups entry of a generated config.
+type generatedResourceGroup struct {
+	Name         string
+	ResourceType string
+	Aggregation  string
+	Metrics      []generatedMetric
+}
+
+type generatedConfig struct {
+	Credentials    config.Credentials
+	ResourceGroups []generatedResourceGroup
+}
+
+var generatedConfigTemplate = template.Must(template.New("config").Funcs(template.FuncMap{
+	"quote": yamlQuote,
+	"join":  strings.Join,
+}).Parse(`# Generated by azure-metrics-exporter generate-config.
+credentials:
+  subscription_id: {{ quote .Credentials.SubscriptionID }}
+  tenant_id: {{ quote .Credentials.TenantID }}
+  client_id: {{ quote .Credentials.ClientID }}
+{{- if .Credentials.ClientSecretFile }}
+  client_secret_file: {{ quote .Credentials.ClientSecretFile }}
+{{- else }}
+  client_secret: "<secret>"
+{{- end }}
+
+resource_groups:
+{{- range .ResourceGroups }}
+  - name: {{ quote .Name }}
+    resource_types:
+      - {{ quote .ResourceType }}
+    metrics:
+{{- range .Metrics }}
+      - {{ quote .Name }}{{ if .Dimensions }} # dimensions: {{ join .Dimensions ", " }}{{ end }}
+{{- end }}
+    aggregations:
+      - {{ quote .Aggregation }}
+{{- end }}
+`))
+
+// yamlQuote returns s as double quoted string, which JSON and YAML share.
+func yamlQuote(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+// generateCredentials returns the credentials given on the command line, falling
+// back to those of the config file if it can be loaded.
+func generateCredentials() (config.Credentials, error) {
+	credentials := config.Credentials{}
+	if cfg, err := config.LoadConfig(*configFile); err == nil {
+		credentials = cfg.Credentials
+	}
+
+	for _, override := range []struct {
+		value  string
+		target *string
+	}{
+		{*generateSubscription, &credentials.SubscriptionID},
+		{*generateTenantID, &credentials.TenantID},
+		{*generateClientID, &credentials.ClientID},
+	} {
+		if override.value != "" {
+			*override.target = override.value
+		}
+	}
+	if *generateClientSecret != "" {
+		credentials.ClientSecret = *generateClientSecret
+		credentials.ClientSecretFile = ""
+	}
+
+	if credentials.SubscriptionID == "" || credentials.TenantID == "" || credentials.ClientID == "" || credentials.ClientSecret == "" {
+		return credentials, fmt.Errorf("subscription, tenant ID, client ID and client secret need to be given as flags or in the config file %s", *configFile)
+	}
+	return credentials, nil
+}
+
+// generateResourceGroupEntries discovers the resources of the configured types in
+// the resource groups selected by name and returns one entry per resource type and
+// primary aggregation.
+func generateResourceGroupEntries(client exporter.AzureAPI, name string) ([]generatedResourceGroup, error) {
+	target := config.ResourceGroup{Name: name, ResourceTypes: *generateResourceTypes}
+	if err := target.Compile(); err != nil {
+		return nil, err
+	}
+	resources, err := exporter.ListResourceGroupTargets(client, target)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []generatedResourceGroup
+	for _, resourceType := range *generateResourceTypes {
+		var resourceID *exporter.ResourceID
+		for _, resource := range resources {
+			id, err := exporter.ParseResourceID(resource.Id)
+			if err == nil && strings.EqualFold(id.ResourceType, resourceType) {
+				resourceID = id
+				break
+			}
+		}
+		if resourceID == nil {
+			log.Printf("No resources of type %s found in resource group %s", resourceType, name)
+			continue
+		}
+
+		definitions, err := client.GetMetricDefinitions(resourceID, "")
+		if err != nil {
+			return nil, err
+		}
+
+		// Group the metrics by primary aggregation, keeping the order of the definitions.
+		byAggregation := make(map[string]*generatedResourceGroup)
+		var order []string
+		for _, d := range definitions.MetricDefinitionResponses {
+			aggregation := d.PrimaryAggregationType
+			if !exporter.IsSupportedAggregation(aggregation) {
+				aggregation = exporter.FallbackAggregation
+			}
+			entry, ok := byAggregation[aggregation]
+			if !ok {
+				entry = &generatedResourceGroup{
+					Name:         name,
+					ResourceType: resourceID.ResourceType,
+					Aggregation:  aggregation,
+				}
+				byAggregation[aggregation] = entry
+				order = append(order, aggregation)
+			}
+
+			metric := generatedMetric{Name: d.Name.Value}
+			for _, dim := range d.Dimensions {
+				metric.Dimensions = append(metric.Dimensions, dim.Value)
+			}
+			entry.Metrics = append(entry.Metrics, metric)
+		}
+
+		for _, aggregation := range order {
+			entries = append(entries, *byAggregation[aggregation])
+		}
+	}
+
+	return entries, nil
+}
+
+// generateConfig writes a config file for the discovered resources and returns the exit code.
+func generateConfig() int {
+	credentials, err := generateCredentials()
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return 1
+	}
+	// Fixtures are redacted using the credentials of the current config.
+	sc.Lock()
+	sc.C = &config.Config{Credentials: credentials}
+	sc.Unlock()
+	client := exporter.NewAzureClient(credentials, httpClient)
+
+	groups := *generateResourceGroups
+	if len(groups) == 0 {
+		groups = []string{"*"}
+	}
+
+	out := generatedConfig{Credentials: credentials}
+	for _, name := range groups {
+		entries, err := generateResourceGroupEntries(client, name)
+		if err != nil {
+			log.Printf("Failed to discover resources in resource group %s: %v", name, err)
+			return 1
+		}
+		out.ResourceGroups = append(out.ResourceGroups, entries...)
+	}
+	if len(out.ResourceGroups) == 0 {
+		log.Printf("No resources found")
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if *generateOutput != "-" {
+		f, err := os.Create(*generateOutput)
+		if err != nil {
+			log.Printf("Error creating output file: %v", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := generatedConfigTemplate.Execute(w, out); err != nil {
+		log.Printf("Error writing config: %v", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/credativ/azure_metrics_exporter/config"
+	"github.com/credativ/azure_metrics_exporter/exporter"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// MetricDefinition is the output format of a single metric definition.
+type MetricDefinition struct {
+	Name                  string   `json:"name"`
+	DisplayName           string   `json:"display_name"`
+	Unit                  string   `json:"unit"`
+	PrimaryAggregation    string   `json:"primary_aggregation"`
+	SupportedAggregations []string `json:"supported_aggregations"`
+	TimeGrains            []string `json:"time_grains"`
+	Dimensions            []string `json:"dimensions"`
+	IsDimensionRequired   bool     `json:"is_dimension_required"`
+}
+
+// ResourceDefinitions is the output format of the metric definitions of one resource.
+type ResourceDefinitions struct {
+	ResourceID   string `json:"resource_id"`
+	ResourceType string `json:"resource_type"`
+	// Namespaces are the metric namespaces of the resource.
+	Namespaces []string `json:"namespaces"`
+	// Namespace is the namespace of Metrics, empty for the default namespace.
+	Namespace string             `json:"namespace,omitempty"`
+	Metrics   []MetricDefinition `json:"metrics"`
+}
+
+func newMetricDefinition(d exporter.AzureMetricDefinition) MetricDefinition {
+	def := MetricDefinition{
+		Name:                  d.Name.Value,
+		DisplayName:           d.Name.LocalizedValue,
+		Unit:                  d.Unit,
+		PrimaryAggregation:    d.PrimaryAggregationType,
+		SupportedAggregations: d.SupportedAggregationTypes,
+		IsDimensionRequired:   d.IsDimensionRequired,
+	}
+	for _, a := range d.MetricAvailabilities {
+		def.TimeGrains = append(def.TimeGrains, a.TimeGrain)
+	}
+	for _, dim := range d.Dimensions {
+		def.Dimensions = append(def.Dimensions, dim.Value)
+	}
+	return def
+}
+
+// selectedResources returns all resources configured directly or selected via resource groups.
+func selectedResources(cfg *config.Config, client exporter.ResourceAPI) []exporter.AzureResource {
+	var resources []exporter.AzureResource
+	seen := make(map[string]bool)
+	add := func(resource exporter.AzureResource) {
+		key := strings.ToLower(resource.Id)
+		if !seen[key] {
+			seen[key] = true
+			resources = append(resources, resource)
+		}
+	}
+
+	for _, target := range cfg.Resources {
+		add(exporter.LookupResource(client, fmt.Sprintf("/subscriptions/%s%s", cfg.Credentials.SubscriptionID, target.Name)))
+	}
+	for _, target := range cfg.ResourceGroups {
+		found, err := exporter.ListResourceGroupTargets(client, target)
+		if err != nil {
+			log.Printf("Failed to list resources of resource group %s: %v", target.Selector(), err)
+			continue
+		}
+		for _, resource := range found {
+			add(resource)
+		}
+	}
+
+	return resources
+}
+
+// collectDefinitions fetches the metric definitions of the given resources in namespace, or in
+// their default namespace if it is empty. Resources whose definitions cannot be fetched are
+// reported and skipped.
+func collectDefinitions(client exporter.MetricAPI, resources []exporter.AzureResource, namespace string) ([]ResourceDefinitions, bool) {
+	results := []ResourceDefinitions{}
+	ok := true
+
+	for _, resource := range resources {
+		resourceID, err := exporter.ParseResourceID(resource.Id)
+		if err != nil {
+			log.Printf("Failed to parse resource %s: %v", resource.Id, err)
+			ok = false
+			continue
+		}
+
+		definitions, err := client.GetMetricDefinitions(resourceID, namespace)
+		if err != nil {
+			log.Printf("Failed to fetch metric definitions for %s: %v", resource.Id, err)
+			ok = false
+			continue
+		}
+
+		result := ResourceDefinitions{
+			ResourceID:   resourceID.ID,
+			ResourceType: resourceID.ResourceType,
+			Namespace:    namespace,
+		}
+		// Not all resource types support metric namespaces, so they are optional.
+		namespaces, err := client.GetMetricNamespaces(resourceID)
+		if err != nil {
+			log.Printf("Failed to fetch metric namespaces for %s: %v", resource.Id, err)
+		}
+		for _, ns := range namespaces.Value {
+			result.Namespaces = append(result.Namespaces, ns.Properties.MetricNamespaceName)
+		}
+		for _, d := range definitions.MetricDefinitionResponses {
+			result.Metrics = append(result.Metrics, newMetricDefinition(d))
+		}
+		results = append(results, result)
+	}
+
+	return results, ok
+}
+
+func writeDefinitionsTable(w io.Writer, results []ResourceDefinitions) error {
+	for _, r := range results {
+		fmt.Fprintf(w, "Resource: %s\nType: %s\n", r.ResourceID, r.ResourceType)
+		if len(r.Namespaces) > 0 {
+			fmt.Fprintf(w, "Namespaces: %s\n", strings.Join(r.Namespaces, ", "))
+		}
+		if r.Namespace != "" {
+			fmt.Fprintf(w, "Namespace: %s\n", r.Namespace)
+		}
+		fmt.Fprintln(w)
+
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "METRIC\tUNIT\tPRIMARY\tAGGREGATIONS\tTIME GRAINS\tDIMENSIONS")
+		for _, m := range r.Metrics {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				m.Name,
+				m.Unit,
+				m.PrimaryAggregation,
+				strings.Join(m.SupportedAggregations, ","),
+				strings.Join(m.TimeGrains, ","),
+				strings.Join(m.Dimensions, ","),
+			)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// definitionsConfig is a resources section of the configuration file listing all
+// metrics of each resource.
+type definitionsConfig struct {
+	Resources []definitionsConfigResource `yaml:"resources"`
+}
+
+type definitionsConfigResource struct {
+	Name      string   `yaml:"name"`
+	Namespace string   `yaml:"namespace,omitempty"`
+	Metrics   []string `yaml:"metrics"`
+}
+
+func writeDefinitionsYAML(w io.Writer, results []ResourceDefinitions, subscriptionID string) error {
+	out := definitionsConfig{}
+	prefix := "/subscriptions/" + subscriptionID
+	for _, r := range results {
+		resource := definitionsConfigResource{Name: r.ResourceID, Namespace: r.Namespace}
+		// Resource names in the config file are relative to the subscription.
+		if strings.HasPrefix(strings.ToLower(r.ResourceID), strings.ToLower(prefix)+"/") {
+			resource.Name = r.ResourceID[len(prefix):]
+		}
+		for _, m := range r.Metrics {
+			resource.Metrics = append(resource.Metrics, m.Name)
+		}
+		out.Resources = append(out.Resources, resource)
+	}
+
+	body, err := yaml.Marshal(out)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+// listDefinitions prints the metric definitions of all selected resources in namespace
+// in the given format and returns the exit code.
+func listDefinitions(format string, namespace string) int {
+	cfg, client := getConfig()
+	results, ok := collectDefinitions(client, selectedResources(cfg, client), namespace)
+
+	var err error
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(results)
+	case "yaml":
+		err = writeDefinitionsYAML(os.Stdout, results, cfg.Credentials.SubscriptionID)
+	default:
+		err = writeDefinitionsTable(os.Stdout, results)
+	}
+	if err != nil {
+		log.Printf("Failed to write metric definitions: %v", err)
+		return 1
+	}
+
+	if !ok {
+		return 1
+	}
+	return 0
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
+	"fmt"
+	"html"
 	"log"
 	"net/http"
 	"os"
-	"regexp"
-	"strings"
 
 	"github.com/credativ/azure_metrics_exporter/config"
+	"github.com/credativ/azure_metrics_exporter/exporter"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/version"
@@ -19,188 +20,102 @@ var (
 	sc = &config.SafeConfig{
 		C: &config.Config{},
 	}
-	ac                    = NewAzureClient()
+	// All Azure clients send their requests with httpClient.
+	httpClient            = &http.Client{}
 	configFile            = kingpin.Flag("config.file", "Azure exporter configuration file.").Default("azure.yml").String()
 	listenAddress         = kingpin.Flag("web.listen-address", "The address to listen on for HTTP requests.").Default(":9276").String()
-	listMetricDefinitions = kingpin.Flag("list.definitions", "List available metric definitions for the given resources and exit.").Bool()
-	invalidMetricChars    = regexp.MustCompile("[^a-zA-Z0-9_:]")
+	listMetricDefinitions = kingpin.Flag("list.definitions", "List available metric definitions for the given resources and exit. Deprecated, use the list definitions command.").Hidden().Bool()
+	checkConfigFile       = kingpin.Flag("config.check", "Validate the config file, including metric names if the Azure API can be reached, and exit.").Bool()
+	watchInterval         = kingpin.Flag("config.watch-interval", "How often to check the config file and referenced files for changes. 0 disables watching.").Default("10s").Duration()
+	watchDebounce         = kingpin.Flag("config.watch-debounce", "How long changed files must stay unchanged before the config is reloaded.").Default("5s").Duration()
+
+	serveCommand           = kingpin.Command("serve", "Run the exporter.").Default()
+	listCommand            = kingpin.Command("list", "List information about the configured resources and exit.")
+	listDefinitionsCommand = listCommand.Command("definitions", "List the metric definitions of all configured and discovered resources.")
+	listOutputFormat       = listDefinitionsCommand.Flag("output", "Output format: table, json or yaml. The yaml output can be used as resources section of the config file.").Short('o').Default("table").Enum("table", "json", "yaml")
+	listNamespace          = listDefinitionsCommand.Flag("namespace", "Metric namespace to list the definitions of, e.g. azure.vm.linux.guestmetrics. Defaults to the platform metrics of each resource.").String()
 )
 
 func init() {
 	prometheus.MustRegister(version.NewCollector("azure_exporter"))
 }
 
-// Collector generic collector type
-type Collector struct{}
-
-// Describe implemented with dummy data to satisfy interface.
-func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- prometheus.NewDesc("dummy", "dummy", nil, nil)
-}
-
-func (c *Collector) collectResource(ch chan<- prometheus.Metric, resource string, metricsStr string, aggregations []string) {
-	metricValueData, err := ac.getMetricValue(resource, metricsStr, aggregations)
-	if err != nil {
-		log.Printf("Failed to get metrics for target %s: %v", resource, err)
-		return
-	}
-
-	if metricValueData.Value == nil {
-		log.Printf("Metric %v not found at target %v\n", metricsStr, resource)
-		return
-	}
-	if len(metricValueData.Value[0].Timeseries[0].Data) == 0 {
-		log.Printf("No metric data returned for metric %v at target %v\n", metricsStr, resource)
-		return
-	}
-
-	for _, value := range metricValueData.Value {
-		// Ensure Azure metric names conform to Prometheus metric name conventions
-		metricName := strings.Replace(value.Name.Value, " ", "_", -1)
-		metricName = strings.ToLower(metricName + "_" + value.Unit)
-		metricName = strings.Replace(metricName, "/", "_per_", -1)
-		metricName = invalidMetricChars.ReplaceAllString(metricName, "_")
-		metricValue := value.Timeseries[0].Data[len(value.Timeseries[0].Data)-1]
-		labels := CreateResourceLabels(value.ID)
-
-		if hasAggregation(aggregations, "Total") {
-			ch <- prometheus.MustNewConstMetric(
-				prometheus.NewDesc(metricName+"_total", metricName+"_total", nil, labels),
-				prometheus.GaugeValue,
-				metricValue.Total,
-			)
-		}
-
-		if hasAggregation(aggregations, "Average") {
-			ch <- prometheus.MustNewConstMetric(
-				prometheus.NewDesc(metricName+"_average", metricName+"_average", nil, labels),
-				prometheus.GaugeValue,
-				metricValue.Average,
-			)
-		}
-
-		if hasAggregation(aggregations, "Minimum") {
-			ch <- prometheus.MustNewConstMetric(
-				prometheus.NewDesc(metricName+"_min", metricName+"_min", nil, labels),
-				prometheus.GaugeValue,
-				metricValue.Minimum,
-			)
-		}
-
-		if hasAggregation(aggregations, "Maximum") {
-			ch <- prometheus.MustNewConstMetric(
-				prometheus.NewDesc(metricName+"_max", metricName+"_max", nil, labels),
-				prometheus.GaugeValue,
-				metricValue.Maximum,
-			)
-		}
-	}
-}
-
-// Collect - collect results from Azure Montior API and create Prometheus metrics.
-func (c *Collector) Collect(ch chan<- prometheus.Metric) {
-	// Get metric values for all defined metrics
-	for _, target := range sc.C.Resources {
-		metricsStr := strings.Join(target.Metrics, ",")
-
-		c.collectResource(ch, target.Name, metricsStr, target.Aggregations)
-	}
-
-	for _, target := range sc.C.ResourceGroups {
-		metricsStr := strings.Join(target.Metrics, ",")
-
-		resources, err := ac.listFromResourceGroup(target.Name, target.ResourceTypes)
-		if err != nil {
-			continue
-		}
-
-		for _, resource := range resources {
-			resource_parts := strings.Split(resource, "/")
-			resource_name := resource_parts[len(resource_parts)-1]
-
-			if len(target.ResourceInclude) != 0 {
-				include := false
-				for _, rx := range target.ResourceInclude {
-					matched, err := regexp.MatchString(rx, resource_name)
-					if err == nil && matched {
-						include = true
-						break
-					}
-				}
-
-				if !include {
-					continue
-				}
-			}
-
-			exclude := false
-			for _, rx := range target.ResourceExclude {
-				matched, err := regexp.MatchString(rx, resource_name)
-				if err == nil && matched {
-					exclude = true
-					break
-				}
-			}
-
-			if exclude {
-				continue
-			}
-
-			c.collectResource(ch, resource, metricsStr, target.Aggregations)
-		}
-	}
-}
-
 func handler(w http.ResponseWriter, r *http.Request) {
+	cfg, client := getConfig()
 	registry := prometheus.NewRegistry()
-	collector := &Collector{}
+	collector := exporter.NewCollector(cfg, client)
 	registry.MustRegister(collector)
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	if activityLog := getActivityLog(); activityLog != nil {
+		registry.MustRegister(exporter.NewActivityLogCollector(cfg, client, activityLog))
+	}
+	h := promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, registry}, promhttp.HandlerOpts{})
 	h.ServeHTTP(w, r)
 }
 
 func main() {
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
-	if err := sc.ReloadConfig(*configFile); err != nil {
+	command := kingpin.Parse()
+	// Set up first, so that responses of all commands can be recorded and replayed.
+	enableFixtures()
+	if command == generateCommand.FullCommand() {
+		os.Exit(generateConfig())
+	}
+	if *checkConfigFile {
+		checkConfig()
+	}
+	if command == scrapeCommand.FullCommand() && *scrapeVerbose {
+		enableVerboseRequests()
+	}
+
+	if err := reloadConfig(); err != nil {
 		log.Fatalf("Error loading config: %v", err)
 		os.Exit(1)
 	}
 
-	err := ac.getAccessToken()
+	_, client := getConfig()
+	_, err := client.RefreshAccessToken()
 	if err != nil {
 		log.Fatalf("Failed to get token: %v", err)
 	}
 
-	// Print list of available metric definitions for each resource to console if specified.
-	if *listMetricDefinitions {
-		results, err := ac.getMetricDefinitions()
-		if err != nil {
-			log.Fatalf("Failed to fetch metric definitions: %v", err)
-		}
-
-		for k, v := range results {
-			log.Printf("Resource: %s\n\nAvailable Metrics:\n", strings.Split(k, "/")[6])
-			for _, r := range v.MetricDefinitionResponses {
-				log.Printf("- %s\n", r.Name.Value)
-			}
-		}
-		os.Exit(0)
+	switch {
+	case *listMetricDefinitions:
+		os.Exit(listDefinitions("table", ""))
+	case command == listDefinitionsCommand.FullCommand():
+		os.Exit(listDefinitions(*listOutputFormat, *listNamespace))
+	case command == scrapeCommand.FullCommand():
+		os.Exit(scrape())
+	case command != serveCommand.FullCommand():
+		log.Fatalf("Unknown command %s", command)
 	}
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`<html>
+		reloadStatus := ""
+		if err := getLastReloadError(); err != nil {
+			reloadStatus = fmt.Sprintf("<p>Last config reload failed: %s</p>", html.EscapeString(err.Error()))
+		}
+		fmt.Fprintf(w, `<html>
             <head>
             <title>Azure Exporter</title>
             </head>
             <body>
             <h1>Azure Exporter</h1>
 						<p><a href="/metrics">Metrics</a></p>
+						<p><a href="/discovery">Service discovery</a></p>
+						%s
             </body>
-            </html>`))
+            </html>`, reloadStatus)
 	})
 
 	http.HandleFunc("/metrics", handler)
+	http.HandleFunc("/probe", probeHandler)
+	http.HandleFunc("/discovery", discoveryHandler)
+	http.HandleFunc("/-/reload", reloadHandler)
+	go watchSignals()
+	if *watchInterval > 0 {
+		go watchConfig(*watchInterval, *watchDebounce)
+	}
+
 	log.Printf("azure_metrics_exporter listening on port %v", *listenAddress)
 	if err := http.ListenAndServe(*listenAddress, nil); err != nil {
 		log.Fatalf("Error starting HTTP server: %v", err)
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/credativ/azure_metrics_exporter/config"
+	"github.com/credativ/azure_metrics_exporter/exporter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// absoluteResourceID returns the full ID of a resource given on its own. Like in the
+// config file, IDs relative to the configured subscription are accepted.
+func absoluteResourceID(cfg *config.Config, resource string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(resource), "/subscriptions/") {
+		resource = fmt.Sprintf("/subscriptions/%s%s", cfg.Credentials.SubscriptionID, resource)
+	}
+	if _, err := exporter.ParseResourceID(resource); err != nil {
+		return "", err
+	}
+	return resource, nil
+}
+
+// splitParams returns all values of a query parameter, which may be repeated or comma separated.
+func splitParams(values []string) []string {
+	var result []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
+
+func probeHandler(w http.ResponseWriter, r *http.Request) {
+	cfg, client := getConfig()
+	params := r.URL.Query()
+
+	target := params.Get("target")
+	if target == "" {
+		http.Error(w, "Target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	target, err := absoluteResourceID(cfg, target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	module := config.Module{}
+	if name := params.Get("module"); name != "" {
+		m, ok := cfg.Modules[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown module %q", name), http.StatusBadRequest)
+			return
+		}
+		module = m
+	}
+	if namespace := params.Get("namespace"); namespace != "" {
+		module.Namespace = namespace
+	}
+	if metrics := splitParams(params["metric"]); len(metrics) > 0 {
+		module.Metrics = metrics
+	}
+	if aggregations := splitParams(params["aggregation"]); len(aggregations) > 0 {
+		module.Aggregations = aggregations
+	}
+	if err := module.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	registry := prometheus.NewRegistry()
+	collector := exporter.NewProbeCollector(cfg, client, target, module)
+	registry.MustRegister(collector)
+	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	h.ServeHTTP(w, r)
+}
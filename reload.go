@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+
+	"github.com/credativ/azure_metrics_exporter/config"
+	"github.com/credativ/azure_metrics_exporter/exporter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	reloadMutex sync.Mutex
+	// The error of the last reload attempt, shown on the landing page.
+	lastReloadError error
+
+	// The Azure client for the credentials of the current configuration, guarded by sc.
+	azureClient *exporter.AzureClient
+
+	// Counts Activity Log events across scrapes and reloads.
+	activityLogMutex sync.RWMutex
+	activityLog      *exporter.ActivityLog
+
+	configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "azure_exporter",
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last configuration reload attempt was successful.",
+	})
+	configReloadSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "azure_exporter",
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful configuration reload.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(configReloadSuccess)
+	prometheus.MustRegister(configReloadSeconds)
+}
+
+// reloadConfig re-reads the configuration file and swaps it in if it is valid.
+// The previous configuration stays active otherwise.
+func reloadConfig() error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	// The client keeps access tokens and cached responses, some of which are expensive to
+	// refresh due to throttling, so it is only replaced if the credentials changed. It is
+	// swapped along with the configuration so that no scrape uses the new configuration
+	// with the old credentials or vice versa.
+	err := sc.ReloadConfig(*configFile, func(cfg *config.Config) {
+		if azureClient == nil || sc.C == nil || !reflect.DeepEqual(cfg.Credentials, sc.C.Credentials) {
+			azureClient = exporter.NewAzureClient(cfg.Credentials, httpClient)
+		}
+	})
+	if err != nil {
+		configReloadSuccess.Set(0)
+		lastReloadError = err
+		return err
+	}
+	lastReloadError = nil
+
+	updateActivityLog(sc.Get())
+
+	configReloadSuccess.Set(1)
+	configReloadSeconds.SetToCurrentTime()
+	return nil
+}
+
+// watchSignals reloads the configuration whenever a SIGHUP is received.
+func watchSignals() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		if err := reloadConfig(); err != nil {
+			log.Printf("Error reloading config: %v", err)
+			continue
+		}
+		log.Printf("Reloaded config file %s", *configFile)
+	}
+}
+
+// getConfig returns the current configuration and the Azure client for its credentials.
+func getConfig() (*config.Config, *exporter.AzureClient) {
+	sc.RLock()
+	defer sc.RUnlock()
+	return sc.C, azureClient
+}
+
+// updateActivityLog sets up counting Activity Log events if configured. Counts are kept
+// across reloads unless the state file changes.
+func updateActivityLog(cfg *config.Config) {
+	activityLogMutex.Lock()
+	defer activityLogMutex.Unlock()
+
+	if cfg.ActivityLog == nil {
+		activityLog = nil
+		return
+	}
+	if activityLog != nil && activityLog.StateFile() == cfg.ActivityLog.StateFile {
+		return
+	}
+
+	a, err := exporter.NewActivityLog(cfg.ActivityLog.StateFile)
+	if err != nil {
+		log.Printf("Error setting up activity log: %v", err)
+		activityLog = nil
+		return
+	}
+	activityLog = a
+}
+
+// getActivityLog returns the Activity Log event counts, or nil if they are not configured.
+func getActivityLog() *exporter.ActivityLog {
+	activityLogMutex.RLock()
+	defer activityLogMutex.RUnlock()
+	return activityLog
+}
+
+// getLastReloadError returns the error of the last reload attempt, if it failed.
+func getLastReloadError() error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	return lastReloadError
+}
+
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "This endpoint requires a POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := reloadConfig(); err != nil {
+		log.Printf("Error reloading config: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to reload config: %s", err), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Reloaded config file %s", *configFile)
+}
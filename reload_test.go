@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// useConfigFile makes the exporter load its configuration from a new file in a temporary
+// directory and resets the loaded configuration. It returns the path of the file.
+func useConfigFile(t *testing.T) string {
+	file := filepath.Join(t.TempDir(), "azure.yml")
+	previous := *configFile
+	*configFile = file
+	t.Cleanup(func() {
+		*configFile = previous
+		sc.C = nil
+		azureClient = nil
+	})
+	return file
+}
+
+func writeFile(t *testing.T, file string, content string) {
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func gaugeValue(t *testing.T, g prometheus.Gauge) float64 {
+	var m dto.Metric
+	if err := g.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetGauge().GetValue()
+}
+
+func TestReloadConfig(t *testing.T) {
+	file := useConfigFile(t)
+
+	writeFile(t, file, testConfig)
+	if err := reloadConfig(); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	if v := gaugeValue(t, configReloadSuccess); v != 1 {
+		t.Errorf("Expected config_last_reload_successful to be 1, got %v", v)
+	}
+	if v := gaugeValue(t, configReloadSeconds); v == 0 {
+		t.Errorf("Expected config_last_reload_success_timestamp_seconds to be set")
+	}
+	cfg, client := getConfig()
+	if len(cfg.Resources) != 1 || client == nil {
+		t.Fatalf("Unexpected config %+v and client %v", cfg, client)
+	}
+
+	// Changes besides the credentials keep the client and its caches.
+	writeFile(t, file, testConfig+`      - Network In
+`)
+	if err := reloadConfig(); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	reloaded, reloadedClient := getConfig()
+	if len(reloaded.Resources[0].Metrics) != 2 {
+		t.Errorf("Expected the changed config to be loaded, got %+v", reloaded.Resources)
+	}
+	if reloadedClient != client {
+		t.Errorf("Expected the client to be kept for unchanged credentials")
+	}
+
+	writeFile(t, file, strings.Replace(testConfig, "client_secret: secret", "client_secret: rotated", 1))
+	if err := reloadConfig(); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	if _, c := getConfig(); c == client {
+		t.Errorf("Expected a new client for changed credentials")
+	}
+}
+
+func TestReloadInvalidConfig(t *testing.T) {
+	file := useConfigFile(t)
+
+	writeFile(t, file, testConfig)
+	if err := reloadConfig(); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	cfg, client := getConfig()
+
+	writeFile(t, file, testConfig+`    unknown_field: 1
+`)
+	if err := reloadConfig(); err == nil {
+		t.Fatalf("Expected an error reloading an invalid config")
+	}
+	if v := gaugeValue(t, configReloadSuccess); v != 0 {
+		t.Errorf("Expected config_last_reload_successful to be 0, got %v", v)
+	}
+	if getLastReloadError() == nil {
+		t.Errorf("Expected the reload error to be kept")
+	}
+	if c, cl := getConfig(); c != cfg || cl != client {
+		t.Errorf("Expected the previous config and client to stay active")
+	}
+
+	writeFile(t, file, testConfig)
+	if err := reloadConfig(); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	if getLastReloadError() != nil || gaugeValue(t, configReloadSuccess) != 1 {
+		t.Errorf("Expected a successful reload to clear the error")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/credativ/azure_metrics_exporter/config"
+	"github.com/credativ/azure_metrics_exporter/exporter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	scrapeCommand      = kingpin.Command("scrape", "Run a single collection and print the resulting metrics.")
+	scrapeResource     = scrapeCommand.Flag("resource", "Only scrape this resource instead of the configured ones. Relative to the configured subscription unless starting with /subscriptions/.").String()
+	scrapeMetrics      = scrapeCommand.Flag("metric", "Metric to scrape for --resource, or all. Can be repeated.").Strings()
+	scrapeAggregations = scrapeCommand.Flag("aggregation", "Aggregation to scrape for --resource. Can be repeated, defaults to all.").Strings()
+	scrapeVerbose      = scrapeCommand.Flag("verbose", "Print each Azure API request with its response status, timing and body.").Short('v').Bool()
+
+	accessTokenValue = regexp.MustCompile(`"access_token"\s*:\s*"[^"]*"`)
+)
+
+// verboseTransport prints each request and its response to out.
+type verboseTransport struct {
+	next http.RoundTripper
+	out  io.Writer
+}
+
+func (t *verboseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	duration := time.Since(start)
+
+	fmt.Fprintf(t.out, "> %s %s\n", req.Method, req.URL)
+	if err != nil {
+		fmt.Fprintf(t.out, "< error after %v: %v\n\n", duration, err)
+		return resp, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	fmt.Fprintf(t.out, "< %s in %v\n", resp.Status, duration)
+	printed := accessTokenValue.ReplaceAll(body, []byte(`"access_token": "<redacted>"`))
+	var indented bytes.Buffer
+	if json.Indent(&indented, printed, "", "  ") == nil {
+		printed = indented.Bytes()
+	}
+	fmt.Fprintf(t.out, "%s\n\n", printed)
+
+	return resp, nil
+}
+
+// enableVerboseRequests makes the Azure clients print all requests to stderr.
+func enableVerboseRequests() {
+	next := httpClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	httpClient.Transport = &verboseTransport{next: next, out: os.Stderr}
+}
+
+// scrape runs a single collection, prints the metrics in the text exposition
+// format and returns the exit code.
+func scrape() int {
+	cfg, client := getConfig()
+
+	var collector prometheus.Collector = exporter.NewCollector(cfg, client)
+	if *scrapeResource != "" {
+		resource, err := absoluteResourceID(cfg, *scrapeResource)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return 1
+		}
+		module := config.Module{Metrics: *scrapeMetrics, Aggregations: *scrapeAggregations}
+		if err := module.Validate(); err != nil {
+			log.Printf("Error: %v", err)
+			return 1
+		}
+		collector = exporter.NewProbeCollector(cfg, client, resource, module)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	families, err := registry.Gather()
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(os.Stdout, mf); err != nil {
+			log.Printf("Error writing metrics: %v", err)
+			return 1
+		}
+	}
+	if err != nil {
+		log.Printf("Error gathering metrics: %v", err)
+		return 1
+	}
+
+	return 0
+}
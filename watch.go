@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+)
+
+// fingerprintFiles returns a hash over the contents of the given files. Reading
+// the contents rather than comparing modification times also catches symlink
+// swaps as done by Kubernetes when a mounted ConfigMap or Secret is updated.
+func fingerprintFiles(files []string) string {
+	h := sha256.New()
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(h, "%s: %v\n", file, err)
+			continue
+		}
+		fmt.Fprintf(h, "%s: %d\n", file, len(content))
+		h.Write(content)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// watchedFiles returns the config file and all files referenced by the current config.
+func watchedFiles() []string {
+	return append([]string{*configFile}, sc.Get().ReferencedFiles()...)
+}
+
+// watchConfig polls the config file and referenced files for changes and reloads
+// the config once they have not changed for the debounce period. If the new
+// config is invalid, the previous one stays active.
+func watchConfig(interval time.Duration, debounce time.Duration) {
+	last := fingerprintFiles(watchedFiles())
+	var changedAt time.Time
+
+	for range time.Tick(interval) {
+		current := fingerprintFiles(watchedFiles())
+		if current != last {
+			last = current
+			changedAt = time.Now()
+			continue
+		}
+
+		if changedAt.IsZero() || time.Since(changedAt) < debounce {
+			continue
+		}
+		changedAt = time.Time{}
+
+		if err := reloadConfig(); err != nil {
+			log.Printf("Error reloading changed config: %v", err)
+			continue
+		}
+		log.Printf("Reloaded changed config file %s", *configFile)
+
+		// The reloaded config may reference different files.
+		last = fingerprintFiles(watchedFiles())
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFingerprintFiles(t *testing.T) {
+	file := useConfigFile(t)
+	secret := filepath.Join(filepath.Dir(file), "secret")
+	writeFile(t, secret, "secret")
+	writeFile(t, file, `
+credentials:
+  subscription_id: `+testSubscription+`
+  tenant_id: `+testTenant+`
+  client_id: `+testClient+`
+  client_secret_file: secret
+resources:
+  - name: /resourceGroups/web/providers/Microsoft.Compute/virtualMachines/web-1
+    metrics:
+      - Percentage CPU
+`)
+	if err := reloadConfig(); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+
+	files := watchedFiles()
+	if len(files) != 2 || files[1] != secret {
+		t.Fatalf("Expected the config and secret file to be watched, got %v", files)
+	}
+
+	before := fingerprintFiles(files)
+	if fingerprintFiles(files) != before {
+		t.Errorf("Expected the fingerprint of unchanged files to stay the same")
+	}
+
+	writeFile(t, secret, "rotated")
+	changed := fingerprintFiles(files)
+	if changed == before {
+		t.Errorf("Expected a change of the secret file to change the fingerprint")
+	}
+
+	if err := os.Remove(secret); err != nil {
+		t.Fatal(err)
+	}
+	if fingerprintFiles(files) == changed {
+		t.Errorf("Expected a removed file to change the fingerprint")
+	}
+}